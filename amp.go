@@ -0,0 +1,85 @@
+package static
+
+import (
+	"bytes"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The template AMP versions of pages are rendered with
+const ampTemplate = "amp"
+
+var (
+	// Attributes AMP doesn't allow on any element
+	ampBannedAttrRe = regexp.MustCompile(`\s+(?:style|on[a-z]+)\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)`)
+	openTagRe       = regexp.MustCompile(`<[a-zA-Z][^>]*>`)
+	widthRe         = regexp.MustCompile(`\bwidth\s*=`)
+	heightRe        = regexp.MustCompile(`\bheight\s*=`)
+)
+
+// addAMPPages adds an AMP version of every page with "amp" set, rendered
+// with amp.template to name.amp.html. It knows its original as
+// {{.canonical}}, and the original links to it as {{.ampURL}}.
+func addAMPPages(pages map[string]*page, dstdir string, c config) {
+	policy := configString(c, "trailingSlash", "")
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		if !configBool(p.config, "amp") || p.draft {
+			continue
+		}
+		u := strings.TrimSuffix(p.url, path.Ext(p.url)) + ".amp.html"
+		ac := cloneConfig(p.config)
+		ac["name"] = name + ".amp"
+		ac["transforms"] = append(configList(p.config, "transforms"), "amp")
+		ac["canonical"] = absURL(c, linkURL(p.url, policy))
+		ac["url"] = relURL(c, linkURL(u, policy))
+		dst := filepath.Join(dstdir, filepath.FromSlash(u))
+		ac["outputFile"] = outputFile(dst)
+		p.config["ampURL"] = absURL(c, linkURL(u, policy))
+		pages[name+".amp"] = &page{
+			name:     name + ".amp",
+			src:      p.src,
+			url:      u,
+			dst:      dst,
+			config:   ac,
+			template: ampTemplate,
+			keys:     p.keys,
+			body:     p.body,
+			variant:  true,
+		}
+	}
+}
+
+// amp turns images into amp-img elements and drops the attributes AMP
+// doesn't allow, like style and event handlers.
+func amp(b []byte) []byte {
+	b = openTagRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		return ampBannedAttrRe.ReplaceAll(tag, nil)
+	})
+	return imgRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		tag = bytes.TrimSuffix(bytes.TrimSuffix(tag, []byte(">")), []byte("/"))
+		tag = bytes.TrimRight(tag, " ")
+		out := append([]byte("<amp-img"), tag[len("<img"):]...)
+		if widthRe.Match(tag) && heightRe.Match(tag) && !bytes.Contains(tag, []byte("layout=")) {
+			out = append(out, ` layout="responsive"`...)
+		}
+		return append(out, "></amp-img>"...)
+	})
+}
+
+// addAMPLink points the page to its AMP version, if it has one, from its
+// head.
+func addAMPLink(b []byte, c config) []byte {
+	u := configString(c, "ampURL", "")
+	if u == "" {
+		return b
+	}
+	link := []byte(`<link rel="amphtml" href="` + u + `">` + "\n")
+	i := bytes.Index(b, []byte("</head>"))
+	if i < 0 {
+		return b
+	}
+	return append(append(append([]byte(nil), b[:i]...), link...), b[i:]...)
+}
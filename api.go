@@ -0,0 +1,137 @@
+package static
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// An Option changes how Build builds a site.
+type Option func(*buildOptions)
+
+type buildOptions struct {
+	data        map[string]interface{}
+	middlewares []Middleware
+}
+
+// A PageResult is a page as rendered, on its way to be written.
+type PageResult struct {
+	// The name of the page, like "blog/post"
+	Name string
+	// Where it is written to, relative to the output directory
+	Path string
+	// What is written, after the transforms and -format-cmd
+	Output []byte
+}
+
+// A Middleware processes the output of every page before it is written,
+// returning it with the Output it should be written with.
+type Middleware func(page PageResult) (PageResult, error)
+
+// The middlewares of the build in progress. Only Build sets them.
+var middlewares []Middleware
+
+// WithData adds values to the config of the site, on top of config.json, as
+// if they were in it. Pages can still override them with ---set. Later
+// options win over earlier ones.
+func WithData(data map[string]interface{}) Option {
+	return func(o *buildOptions) {
+		for k, v := range data {
+			o.data[k] = v
+		}
+	}
+}
+
+// WithMiddleware adds middlewares that run on the output of every page, in
+// the order they are given, after those of earlier options. An error stops
+// the build, and Build returns an Error wrapping it.
+func WithMiddleware(m ...Middleware) Option {
+	return func(o *buildOptions) {
+		o.middlewares = append(o.middlewares, m...)
+	}
+}
+
+// An Error stops a build: a mistake in the site, or something static can't
+// read or write.
+type Error struct {
+	// What the static command exits with, 1 unless it is one of the mistakes
+	// new users make most
+	Code int
+	Msg  string
+	// What caused it, if it came from the caller, like a Middleware
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns the error e was caused by, so errors.Is and errors.As see
+// the error a Middleware returned.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// fatal stops the build, like log.Fatal stops a program. Build and Run
+// return the Error.
+func fatal(v ...interface{}) {
+	panic(&Error{Code: 1, Msg: fmt.Sprint(v...)})
+}
+
+// catch recovers from fatal and exit, setting *err to the Error. Any other
+// panic is a bug, and goes on.
+func catch(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*err = e
+	}
+}
+
+// Build builds the site in srcdir into dstdir, with the settings in Flags,
+// like a plain run of static does.
+func Build(srcdir string, dstdir string, opts ...Option) (err error) {
+	defer catch(&err)
+	config, templates := loadSite(srcdir, opts...)
+	middlewares = options(opts).middlewares
+	defer func() { middlewares = nil }()
+	build(srcdir, dstdir, config, templates)
+	return nil
+}
+
+// loadSite reads the config and the templates of the site in srcdir, and
+// checks that it can be built.
+func loadSite(srcdir string, opts ...Option) (config, map[string]*template.Template) {
+	o := options(opts)
+	checkSrcDir(srcdir)
+	config := readConfig(srcdir)
+	for k, v := range o.data {
+		config[k] = v
+	}
+	checkRequirements(config)
+	prepareConfig(srcdir, config)
+	templates := readTemplates(srcdir, config)
+	checkDefaultTemplate(config, templates)
+	return config, templates
+}
+
+func options(opts []Option) buildOptions {
+	o := buildOptions{data: make(map[string]interface{})}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// runMiddlewares passes the output of the page through the middlewares.
+func runMiddlewares(p *page, out []byte) []byte {
+	r := PageResult{Name: p.name, Path: p.url, Output: out}
+	for _, m := range middlewares {
+		var err error
+		if r, err = m(r); err != nil {
+			panic(&Error{Code: 1, Msg: "Processing " + p.name + ": " + err.Error(), Err: err})
+		}
+	}
+	return r.Output
+}
@@ -0,0 +1,268 @@
+package static
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var archive = Flags.String("archive", "", "also write the output to this .zip, .tar or .tar.gz file")
+
+// An archiver adds the file at path to an archive under name.
+type archiver interface {
+	add(name string, info os.FileInfo, path string) error
+	Close() error
+}
+
+// writeArchive packs the contents of dir into the archive file at out. The
+// format is chosen from the extension of out.
+func writeArchive(dir string, out string) {
+	say("Writing archive " + out + ".")
+	f, err := os.Create(out)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+
+	var a archiver
+	// Closing the archive doesn't close the gzip stream below it
+	var gz *gzip.Writer
+	switch {
+	case strings.HasSuffix(out, ".zip"):
+		a = zipArchiver{zip.NewWriter(f)}
+	case strings.HasSuffix(out, ".tar.gz"), strings.HasSuffix(out, ".tgz"):
+		gz = gzip.NewWriter(f)
+		a = tarArchiver{tar.NewWriter(gz)}
+	case strings.HasSuffix(out, ".tar"):
+		a = tarArchiver{tar.NewWriter(f)}
+	default:
+		fatal("Unknown archive format for " + out + ", use .zip, .tar or .tar.gz.")
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return a.add(filepath.ToSlash(rel), info, path)
+	})
+	if err != nil {
+		fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		fatal(err)
+	}
+}
+
+type zipArchiver struct {
+	*zip.Writer
+}
+
+// Symlinks, as "symlinks": "preserve" leaves them, are stored the way zip
+// does, with their target as their contents.
+func (a zipArchiver) add(name string, info os.FileInfo, path string) error {
+	h, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	h.Method = zip.Deflate
+	w, err := a.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, target)
+		return err
+	}
+	return copyInto(w, path)
+}
+
+type tarArchiver struct {
+	*tar.Writer
+}
+
+func (a tarArchiver) add(name string, info os.FileInfo, path string) error {
+	target := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if target, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	h, err := tar.FileInfoHeader(info, target)
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if err := a.WriteHeader(h); err != nil {
+		return err
+	}
+	// A symlink is all header
+	if target != "" {
+		return nil
+	}
+	return copyInto(a, path)
+}
+
+func copyInto(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// The .zip file given as -src, which the sources are read from as if it
+// were a directory: a path below it, like site.zip/index.page, is that file
+// in the archive
+var srcArchive struct {
+	path string
+	fsys fs.FS
+}
+
+// openSource opens the .zip file src to build from, and returns the src
+// directory in it, with a function closing it. An archive holding just one
+// directory, as zipping a directory gives, is built from that directory.
+func openSource(src string) (string, func()) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		fatal(err)
+	}
+	tops := make(map[string]bool)
+	for _, f := range r.File {
+		name := path.Clean(f.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			r.Close()
+			fatal(src + " has " + f.Name + ", which is outside of the archive.")
+		}
+		tops[strings.SplitN(name, "/", 2)[0]] = true
+	}
+	srcArchive.path, srcArchive.fsys = filepath.Clean(src), r
+	dir := srcArchive.path
+	if len(tops) == 1 {
+		for top := range tops {
+			if info, err := fs.Stat(r, top); err == nil && info.IsDir() {
+				dir = filepath.Join(dir, top)
+			}
+		}
+	}
+	return dir, func() {
+		r.Close()
+		srcArchive.path, srcArchive.fsys = "", nil
+	}
+}
+
+// inArchive returns the name in the -src archive of the file at p, if it is
+// in there.
+func inArchive(p string) (string, bool) {
+	if srcArchive.fsys == nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(srcArchive.path, filepath.Clean(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// readSrcFile, openSrc, statSrc, lstatSrc, readlinkSrc, walkSrc and globSrc
+// are ioutil.ReadFile, os.Open, os.Stat, os.Lstat, os.Readlink,
+// filepath.Walk and filepath.Glob for the sources, which read what is in the
+// -src archive from there.
+
+func readSrcFile(p string) ([]byte, error) {
+	if name, ok := inArchive(p); ok {
+		return fs.ReadFile(srcArchive.fsys, name)
+	}
+	return ioutil.ReadFile(p)
+}
+
+func openSrc(p string) (fs.File, error) {
+	if name, ok := inArchive(p); ok {
+		return srcArchive.fsys.Open(name)
+	}
+	return os.Open(p)
+}
+
+func statSrc(p string) (os.FileInfo, error) {
+	if name, ok := inArchive(p); ok {
+		return fs.Stat(srcArchive.fsys, name)
+	}
+	return os.Stat(p)
+}
+
+// Symlinks in the archive aren't followed, so there it is the same as
+// statSrc.
+func lstatSrc(p string) (os.FileInfo, error) {
+	if name, ok := inArchive(p); ok {
+		return fs.Stat(srcArchive.fsys, name)
+	}
+	return os.Lstat(p)
+}
+
+// A symlink in a zip file holds where it points.
+func readlinkSrc(p string) (string, error) {
+	if name, ok := inArchive(p); ok {
+		b, err := fs.ReadFile(srcArchive.fsys, name)
+		return string(b), err
+	}
+	return os.Readlink(p)
+}
+
+func walkSrc(root string, fn filepath.WalkFunc) error {
+	name, ok := inArchive(root)
+	if !ok {
+		return filepath.Walk(root, fn)
+	}
+	return fs.WalkDir(srcArchive.fsys, name, func(p string, d fs.DirEntry, err error) error {
+		file := filepath.Join(srcArchive.path, filepath.FromSlash(p))
+		if err != nil {
+			return fn(file, nil, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fn(file, nil, err)
+		}
+		return fn(file, info, nil)
+	})
+}
+
+func globSrc(pattern string) ([]string, error) {
+	name, ok := inArchive(pattern)
+	if !ok {
+		return filepath.Glob(pattern)
+	}
+	matches, err := fs.Glob(srcArchive.fsys, name)
+	for i, m := range matches {
+		matches[i] = filepath.Join(srcArchive.path, filepath.FromSlash(m))
+	}
+	return matches, err
+}
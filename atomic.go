@@ -0,0 +1,96 @@
+package static
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var atomic = Flags.Bool("atomic", false, "build into a temporary directory next to dst and only replace dst once the build succeeded")
+
+// atomicDir returns the empty directory to build dstdir in with -atomic. It
+// is a hidden sibling of dstdir, so it can be renamed onto it. A failed build
+// removes it, but whatever one that was killed left there is removed first.
+func atomicDir(dstdir string) string {
+	dir := atomicDirName(dstdir)
+	if err := os.RemoveAll(dir); err != nil {
+		fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatal(err)
+	}
+	return dir
+}
+
+func atomicDirName(dstdir string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(dstdir)), "."+filepath.Base(dstdir)+"-building")
+}
+
+// The directory an -atomic build is in, and the one it is swapped in for
+var atomicBuild struct {
+	dir, dstdir string
+}
+
+// outputFile returns where the file dst, written by the build in progress,
+// is once the build is done. With -atomic that is elsewhere.
+func outputFile(dst string) string {
+	if atomicBuild.dir == "" {
+		return dst
+	}
+	return filepath.Join(atomicBuild.dstdir, filepath.FromSlash(relSlash(atomicBuild.dir, dst)))
+}
+
+// swapDir puts the finished build in tmp in place of dstdir. The paths in
+// dstdir matching the keep patterns are moved over first. Directories can't
+// be renamed onto each other, so the old output is moved aside and removed
+// afterwards: only between those two renames is there no dstdir.
+func swapDir(tmp string, dstdir string, keep []string) {
+	if _, err := os.Stat(dstdir); os.IsNotExist(err) {
+		if err := os.Rename(tmp, dstdir); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	moveKept(dstdir, tmp, "", keep)
+	old := tmp + "-old"
+	if err := os.RemoveAll(old); err != nil {
+		fatal(err)
+	}
+	if err := os.Rename(dstdir, old); err != nil {
+		fatal(err)
+	}
+	if err := os.Rename(tmp, dstdir); err != nil {
+		fatal(err)
+	}
+	if err := os.RemoveAll(old); err != nil {
+		fatal(err)
+	}
+}
+
+// moveKept moves the paths below rel in from that match the keep patterns to
+// the same place in to, unless the build wrote something there itself.
+func moveKept(from string, to string, rel string, keep []string) {
+	paths, err := filepath.Glob(filepath.Join(from, filepath.FromSlash(rel), "*"))
+	if err != nil {
+		fatal(err)
+	}
+	for _, p := range paths {
+		name := path.Join(rel, filepath.Base(p))
+		dst := filepath.Join(to, filepath.FromSlash(name))
+		if keepMatch(keep, name, false) {
+			if _, err := os.Lstat(dst); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				fatal(err)
+			}
+			if err := os.Rename(p, dst); err != nil {
+				fatal(err)
+			}
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() && keepMatch(keep, name, true) {
+			moveKept(from, to, name, keep)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Static builds a website from templates and pages. What it does, and its
+// flags, are described in the documentation of the package it runs,
+// github.com/mklencke/static.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mklencke/static"
+)
+
+func main() {
+	err := static.Run(os.Args[1:])
+	var e *static.Error
+	switch {
+	case err == nil:
+	case errors.As(err, &e) && e.Code != 1:
+		// Meant for the user, so without the time in front
+		fmt.Fprintln(os.Stderr, e.Msg)
+		os.Exit(e.Code)
+	default:
+		log.Fatal(err)
+	}
+}
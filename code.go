@@ -0,0 +1,50 @@
+package static
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var lineRangeRe = regexp.MustCompile(`^(.+):(\d+)-(\d+)$`)
+
+// includeCode returns the file at path, relative to the directory of the page
+// at src, as a fenced code block in lang. A path ending in :10-20 includes
+// only those lines, counting from 1. It also returns the path of the file.
+func includeCode(name string, src string, path string, lang string) ([]byte, string) {
+	first, last := 0, 0
+	if m := lineRangeRe.FindStringSubmatch(path); m != nil {
+		path = m[1]
+		first, _ = strconv.Atoi(m[2])
+		last, _ = strconv.Atoi(m[3])
+		if first < 1 || last < first {
+			fatal("Including code in " + name + ": bad line range " + m[2] + "-" + m[3] + ".")
+		}
+	}
+	file := filepath.Join(filepath.Dir(src), filepath.FromSlash(path))
+	b, err := readSrcFile(file)
+	if err != nil {
+		fatal("Including code in " + name + ": " + err.Error())
+	}
+	code := strings.TrimSuffix(string(b), "\n")
+	if first > 0 {
+		lines := strings.Split(code, "\n")
+		if last > len(lines) {
+			fatal("Including code in " + name + ": " + path + " has only " + strconv.Itoa(len(lines)) + " lines.")
+		}
+		code = strings.Join(lines[first-1:last], "\n")
+	}
+
+	// The fence has to be longer than any run of backticks in the code
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	var out bytes.Buffer
+	out.WriteString(fence + lang + "\n")
+	out.WriteString(code + "\n")
+	out.WriteString(fence + "\n")
+	return out.Bytes(), file
+}
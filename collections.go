@@ -0,0 +1,247 @@
+package static
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The template functions below work on lists of configs, like {{.pages}},
+// and on lists of other maps, like the rows of a CSV file in {{.data}}.
+
+// toConfigs returns list as a list of configs, or an error if it is not a
+// list of maps.
+func toConfigs(list interface{}) ([]config, error) {
+	switch l := list.(type) {
+	case nil:
+		return nil, nil
+	case []config:
+		return l, nil
+	case []map[string]interface{}:
+		out := make([]config, len(l))
+		for i, m := range l {
+			out[i] = m
+		}
+		return out, nil
+	case []map[string]string:
+		out := make([]config, len(l))
+		for i, m := range l {
+			out[i] = stringsConfig(m)
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]config, len(l))
+		for i, v := range l {
+			switch m := v.(type) {
+			case config:
+				out[i] = m
+			case map[string]interface{}:
+				out[i] = m
+			case map[string]string:
+				out[i] = stringsConfig(m)
+			default:
+				return nil, fmt.Errorf("%v is not a map", v)
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%T is not a list of maps", list)
+}
+
+func stringsConfig(m map[string]string) config {
+	c := make(config, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// where returns the items of list whose key is value. Values are compared
+// as text, so 10 from JSON matches "10" from a ---set directive. Items with
+// a list under key match if value is in the list.
+func where(list interface{}, key string, value interface{}) ([]config, error) {
+	items, err := toConfigs(list)
+	if err != nil {
+		return nil, err
+	}
+	want := fmt.Sprint(value)
+	var out []config
+	for _, c := range items {
+		if matches(c[key], want) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func matches(v interface{}, want string) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case []string, []interface{}:
+		for _, s := range toStrings(v) {
+			if s == want {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(v) == want
+}
+
+// first returns the first n items of list, as in {{range first 5 .pages}}.
+func first(n int, list interface{}) ([]config, error) {
+	items, err := toConfigs(list)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(items) {
+		items = items[:n]
+	}
+	return items, nil
+}
+
+// after returns the items of list after the first n.
+func after(n int, list interface{}) ([]config, error) {
+	items, err := toConfigs(list)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(items) {
+		n = len(items)
+	}
+	return items[n:], nil
+}
+
+// sortBy returns a copy of list sorted by key, in "asc" order unless "desc"
+// is given. Values that are all numbers are sorted as numbers, anything else
+// as text, which works for dates too. Items without the key go last.
+func sortBy(list interface{}, key string, order ...string) ([]config, error) {
+	items, err := toConfigs(list)
+	if err != nil {
+		return nil, err
+	}
+	items = append([]config(nil), items...)
+	desc := len(order) > 0 && order[0] == "desc"
+	numeric := true
+	for _, c := range items {
+		if _, ok := c[key]; ok && !isNumber(c[key]) {
+			numeric = false
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i][key], items[j][key]
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if numeric {
+			if desc {
+				return configNumber(items[i], key) > configNumber(items[j], key)
+			}
+			return configNumber(items[i], key) < configNumber(items[j], key)
+		}
+		if desc {
+			return fmt.Sprint(a) > fmt.Sprint(b)
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	return items, nil
+}
+
+func isNumber(v interface{}) bool {
+	switch v := v.(type) {
+	case float64:
+		return true
+	case string:
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	}
+	return false
+}
+
+// groupByDate groups the items of list by their "date" formatted with
+// layout, for archives: {{range groupByDate "2006" .pages}} gives each year
+// as .key with its .pages. Groups are newest first; within a group the
+// items keep their order. Items without a date are left out.
+func groupByDate(layout string, list interface{}) ([]config, error) {
+	items, err := toConfigs(list)
+	if err != nil {
+		return nil, err
+	}
+	type group struct {
+		newest time.Time
+		c      config
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	for _, c := range items {
+		d := configDate(c, "date")
+		if d.IsZero() {
+			continue
+		}
+		key := d.Format(layout)
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{d, config{"key": key, "pages": []config(nil)}}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.c["pages"] = append(g.c["pages"].([]config), c)
+		if d.After(g.newest) {
+			g.newest = d
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].newest.After(groups[j].newest)
+	})
+	out := make([]config, len(groups))
+	for i, g := range groups {
+		out[i] = g.c
+	}
+	return out, nil
+}
+
+// sortedKeys returns the keys of the map m in order.
+func sortedKeys(m interface{}) ([]string, error) {
+	c, err := toConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// sortedMap returns the entries of the map m ordered by key, each as a .key
+// and .value, so they work with first, where and the other functions on
+// lists: {{range first 3 (sortedMap .nav)}}.
+func sortedMap(m interface{}) ([]config, error) {
+	c, err := toConfig(m)
+	if err != nil {
+		return nil, err
+	}
+	keys, _ := sortedKeys(c)
+	out := make([]config, len(keys))
+	for i, k := range keys {
+		out[i] = config{"key": k, "value": c[k]}
+	}
+	return out, nil
+}
+
+func toConfig(m interface{}) (config, error) {
+	switch m := m.(type) {
+	case nil:
+		return nil, nil
+	case config:
+		return m, nil
+	case map[string]interface{}:
+		return m, nil
+	case map[string]string:
+		return stringsConfig(m), nil
+	}
+	return nil, fmt.Errorf("%T is not a map", m)
+}
@@ -0,0 +1,95 @@
+package static
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// The config helpers below read values whatever form they ended up in: as
+// parsed from JSON, after cloneConfig, or as set by a ---set directive.
+
+// configBool accepts both JSON booleans and "true" from a ---set directive.
+func configBool(c config, key string) bool {
+	switch v := c[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func configString(c config, key string, def string) string {
+	if s, ok := c[key].(string); ok {
+		return s
+	}
+	return def
+}
+
+// configNumber reads a number from the JSON config or from a ---set
+// directive. Anything else counts as 0.
+func configNumber(c config, key string) float64 {
+	switch v := c[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+// configDate reads a date in dateLayout. Pages without a valid date get the
+// zero time, so they sort last.
+func configDate(c config, key string) time.Time {
+	t, _ := time.Parse(dateLayout, configString(c, key, ""))
+	return t
+}
+
+// configMap reads an object from the config.
+func configMap(c config, key string) map[string]interface{} {
+	switch v := c[key].(type) {
+	case map[string]interface{}:
+		return v
+	case map[string]string:
+		m := make(map[string]interface{})
+		for k, v2 := range v {
+			m[k] = v2
+		}
+		return m
+	}
+	return nil
+}
+
+// configList reads a list of strings from the config. A single string, as
+// given by a ---set directive, is split on commas.
+func configList(c config, key string) []string {
+	return toStrings(c[key])
+}
+
+func toStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, v2 := range v {
+			if str, ok := v2.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	case string:
+		var s []string
+		for _, str := range strings.Split(v, ",") {
+			if str = strings.TrimSpace(str); str != "" {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
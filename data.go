@@ -0,0 +1,109 @@
+package static
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// The directory below src holding data files for templates
+const dataDir = "data"
+
+// readData reads the files in the data directory into a map keyed by their
+// name without extension, for templates to use as {{.data.team}}. Files in
+// subdirectories end up in nested maps. JSON files keep their structure; CSV
+// and TSV files become a list of rows.
+func readData(srcdir string, c config) map[string]interface{} {
+	data := make(map[string]interface{})
+	root := filepath.Join(srcdir, dataDir)
+	if _, err := statSrc(root); os.IsNotExist(err) {
+		return data
+	}
+	err := walkSrc(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		var v interface{}
+		switch ext {
+		case ".json":
+			v = readJSONData(path)
+		case ".csv":
+			v = readCSVData(path, ',', c)
+		case ".tsv":
+			v = readCSVData(path, '\t', c)
+		default:
+			return nil
+		}
+		keys := strings.Split(filepath.ToSlash(strings.TrimSuffix(rel, ext)), "/")
+		m := data
+		for _, key := range keys[:len(keys)-1] {
+			sub, ok := m[key].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				m[key] = sub
+			}
+			m = sub
+		}
+		m[keys[len(keys)-1]] = v
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+	return data
+}
+
+func readJSONData(path string) interface{} {
+	b, err := readSrcFile(path)
+	if err != nil {
+		fatal(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		fatal("Reading data " + path + ": " + err.Error())
+	}
+	return v
+}
+
+// readCSVData reads a table. By default the first row names the columns and
+// every other row becomes a map from column to value. With "header" set to
+// false under "csv" in the config, rows are lists of values instead. The
+// "delimiter" there replaces comma or tab.
+func readCSVData(path string, delimiter rune, c config) interface{} {
+	opts := config(configMap(c, "csv"))
+	if d, _ := utf8.DecodeRuneInString(configString(opts, "delimiter", "")); d != utf8.RuneError {
+		delimiter = d
+	}
+	f, err := openSrc(path)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comma = delimiter
+	rows, err := r.ReadAll()
+	if err != nil {
+		fatal("Reading data " + path + ": " + err.Error())
+	}
+
+	if _, ok := opts["header"]; ok && !configBool(opts, "header") || len(rows) == 0 {
+		return rows
+	}
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]string)
+		for i, column := range rows[0] {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records
+}
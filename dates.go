@@ -0,0 +1,124 @@
+package static
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The names of months, January first, and days, Sunday first, in a language
+type dateNames struct {
+	months, shortMonths, days, shortDays []string
+}
+
+// The languages dateFormatLang knows. golang.org/x/text has the names of
+// every language in its CLDR tables, but doesn't export them, so these are
+// kept by hand, and other languages are an error.
+var languageDateNames = map[string]dateNames{
+	"de": {
+		[]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		[]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		[]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		[]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	},
+	"en": {
+		[]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		[]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		[]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		[]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	},
+	"es": {
+		[]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		[]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		[]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		[]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	"fr": {
+		[]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		[]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		[]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		[]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	"it": {
+		[]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		[]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		[]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		[]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	"nl": {
+		[]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		[]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		[]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		[]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	},
+	"pt": {
+		[]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		[]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		[]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		[]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	},
+}
+
+// The parts of a layout that are names, longest first so January isn't
+// taken for Jan
+var nameLayoutRe = regexp.MustCompile(`January|Jan|Monday|Mon`)
+
+// dateFormatLang formats date, a time or a YYYY-MM-DD string like {{.date}},
+// with the Go layout, naming months and days in lang, like "nl" or "nl-BE":
+// {{dateFormatLang "2 January 2006" .date .lang}} gives "1 maart 2024", and
+// Jan and Mon give the usual short names. Without a lang, the "lang" of the
+// site is used, or else English.
+func dateFormatLang(c config) func(layout string, date interface{}, lang ...string) (string, error) {
+	return func(layout string, date interface{}, lang ...string) (string, error) {
+		var t time.Time
+		switch d := date.(type) {
+		case time.Time:
+			t = d
+		case string:
+			var err error
+			if t, err = time.Parse(dateLayout, d); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("%v is not a date", date)
+		}
+		code := langCode(c, lang)
+		names, ok := languageDateNames[code]
+		if !ok {
+			return "", fmt.Errorf("no names of months and days for language %s", code)
+		}
+
+		var out strings.Builder
+		last := 0
+		for _, loc := range nameLayoutRe.FindAllStringIndex(layout, -1) {
+			out.WriteString(t.Format(layout[last:loc[0]]))
+			switch layout[loc[0]:loc[1]] {
+			case "January":
+				out.WriteString(names.months[t.Month()-1])
+			case "Jan":
+				out.WriteString(names.shortMonths[t.Month()-1])
+			case "Monday":
+				out.WriteString(names.days[t.Weekday()])
+			case "Mon":
+				out.WriteString(names.shortDays[t.Weekday()])
+			}
+			last = loc[1]
+		}
+		out.WriteString(t.Format(layout[last:]))
+		return out.String(), nil
+	}
+}
+
+// langCode returns the language of the first of lang, or else of the "lang"
+// of the site, or else English, without a region: "nl" for "nl-BE".
+func langCode(c config, lang []string) string {
+	code := configString(c, "lang", "en")
+	if len(lang) > 0 && lang[0] != "" {
+		code = lang[0]
+	}
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	return strings.ToLower(code)
+}
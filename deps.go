@@ -0,0 +1,101 @@
+package static
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// A dependency on every file of the site, for pages showing other pages
+const anyFile = "*"
+
+// Fields and functions with which a template can show any other page or
+// file, or link to one where it is written
+var siteWideNames = []string{"pages", "sectionPages", "renderPage", "relref", "files", "sri", "siteJSON", "readFile", "pageExists"}
+
+// pageDeps returns the files, relative to srcdir and with forward slashes,
+// each page depends on besides its source and data file, keyed the same way
+// by its source: the template it's rendered with, the files it includes
+// with ---code, the data directory if its template uses {{.data}}, and
+// anyFile if the template can show other pages. Generated pages depend on
+// everything anyway and are left out.
+func pageDeps(srcdir string, pages map[string]*page, templates map[string]*template.Template) map[string][]string {
+	deps := make(map[string][]string)
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		if p.src == "" {
+			continue
+		}
+		rel := relSlash(srcdir, p.src)
+		files := make(map[string]bool)
+		for _, dep := range deps[rel] {
+			files[dep] = true
+		}
+		for _, file := range p.includes {
+			files[relSlash(srcdir, file)] = true
+		}
+		t, used := lookupTemplate(p.templateName(templates), p.config, templates)
+		if t != nil {
+			files[used+".template"] = true
+			names := templateNames(t)
+			if names["data"] {
+				files[dataDir+"/"] = true
+			}
+			for _, n := range siteWideNames {
+				if names[n] {
+					files[anyFile] = true
+				}
+			}
+		}
+		list := make([]string, 0, len(files))
+		for file := range files {
+			list = append(list, file)
+		}
+		sort.Strings(list)
+		deps[rel] = list
+	}
+	return deps
+}
+
+// addDependents adds to only, the sources changed for a partial build, the
+// sources of the pages that depend on any of them by the rules of pageDeps:
+// a changed ---code file, part or data file renders the pages using it
+// again.
+func addDependents(srcdir string, pages map[string]*page, templates map[string]*template.Template, only map[string]bool) {
+	var changed []string
+	for file := range only {
+		changed = append(changed, relSlash(srcdir, file))
+	}
+	deps := pageDeps(srcdir, pages, templates)
+	for _, p := range pages {
+		if p.src == "" || only[p.src] {
+			continue
+		}
+		for _, file := range changed {
+			if dependsOn(deps[relSlash(srcdir, p.src)], file) {
+				only[p.src] = true
+				break
+			}
+		}
+	}
+}
+
+// dependsOn tells whether a page with deps depends on the file rel. A
+// dependency ending in a slash is on everything in that directory.
+func dependsOn(deps []string, rel string) bool {
+	for _, dep := range deps {
+		if dep == anyFile || dep == rel || strings.HasSuffix(dep, "/") && strings.HasPrefix(rel, dep) {
+			return true
+		}
+	}
+	return false
+}
+
+func relSlash(dir string, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -4,5 +4,442 @@ into output HTML + assets.
 
 It looks in the src directory and finds files ending in '.page'. Those are all
 processed and turned into '.html' files, written to the out directory.
+Subdirectories are processed as well, keeping the same layout in the output.
+The directories static writes to, like the -cache and the output ones, are
+skipped even when they are below the src directory.
+With -page-ext .md the pages are the '.md' files instead, which editors
+recognize as markdown.
+
+The static command, in cmd/static, runs the site generator in this package
+with Run. Programs can also import it and build sites with Build, which
+returns an *Error instead of exiting when a site can't be built, and takes
+Options like WithData; the flags are set on Flags.
+
+As building clears the output directory first, the src directory has to be
+marked as a site, by an empty '.static-site' file or a "version" key in its
+config.json. -no-marker skips this check. Files in the output directory that
+come from elsewhere, like a .git directory or a CNAME file, survive when
+they match one of the glob patterns listed under "keep" in the config, for
+example [".git", "CNAME", "downloads/*.iso"].
+
+With -atomic the site is built in a hidden directory next to the output
+directory, which only replaces the output once the build succeeded, taking
+along the files to keep. A failed build leaves the old output as it was,
+and removes the hidden directory with what it wrote.
+
+The src directory can also be a .zip file, as CI jobs may get their content
+as, like -src site.zip. The config, templates, pages and statics are read
+from the archive itself, without unpacking it; the output still goes to the
+dst directory. An archive holding a single directory is built from that
+directory. Without a git checkout, {{.buildVersion}} is "unknown" and -since
+can't be used.
+
+With -since and a git ref, like "-since HEAD~1", only the pages and statics
+git reports as changed since are built, along with the pages depending on a
+changed data file, ---code file or part, by the same rules as -since-mtime
+below. A changed template or config builds everything.
+
+A subdirectory containing an 'index.page' is a page bundle: the other files in
+it are copied next to the rendered page and listed in {{.resources}}.
+
+Templates are read from the '.template' files in the src directory. Any of
+'default' and 'list' that the site doesn't define come from a simple theme
+built into the binary, so a site can consist of content only.
+
+Templates that also hold markup for Vue, Angular or the like, which use {{ }}
+themselves, can use other delimiters for static with "templateDelims" in the
+config, like ["[[", "]]"]; {{ }} is then passed through to the output. All of
+the site's templates use the same delimiters, including the templates they
+{{define}} and include, so they can't be mixed. The templates of the built-in
+theme keep using {{ }}.
+
+Pages without ---settemplate are rendered with the template for their kind,
+if the site has one: 'home.template' for the index page in the root and
+'single.template' for the others. Without it they fall back to the default
+template. Templates see the kind as {{.kind}}: "home", "single", or "list"
+for generated listings.
+
+Values that are too long for ---set lines can be put in a JSON file next to
+the page, post.page.json for post.page. Its keys are added to the config of
+that page before the ---set lines are applied.
+
+Pages are markdown unless they ---set format to "html", for HTML that is used
+as it is, or "text", for plain text that is written to a '.txt' file.
+
+Markdown is converted by the external markdown command. Other converters can
+be configured as profiles under "markdownProfiles", mapping a name to a
+command line, for example {"gfm": "cmark-gfm", "commonmark": "cmark"}. A page
+picks one with ---set markdown gfm; setting "markdown" in the config picks the
+default for all pages.
+A profile can also be a pipeline of commands, each reading what the one
+before it wrote, like "docs-pre | cmark-gfm | docs-post", or the same as a
+list of argument lists: [["docs-pre"], ["cmark-gfm", "--unsafe"],
+["docs-post"]]. A failing stage is named by its number and page, and each
+stage gets -markdown-timeout to finish.
+Sites of HTML only can build with -no-markdown, which takes markdown pages and
+---setmarkdownblock values to be HTML already, so no markdown command is
+needed. Directives work as always.
+
+Raw HTML in markdown, like <div> or <script>, is replaced by a comment
+before conversion, with a warning, so pages written by people who can't be
+trusted with the site can't run scripts in it or change how it looks beyond
+what markdown allows. Links and images are kept to http, https and mailto
+URLs, or relative ones: any other, like [x](javascript:alert(1)), points to
+# instead, also with a warning. HTML comments, autolinks and code are kept.
+This relies on the markdown command escaping the rest, as converters do.
+Sites whose content is all trusted can set "markdownUnsafe" to pass raw
+HTML and any link through as the markdown command sees fit, like before;
+anyone who can write a page of such a site can then do anything on it that
+its own scripts can.
+
+Converted markdown is kept in the -cache directory, keyed by the markdown and
+the command converting it, so unchanged pages aren't converted again by the
+next build. The least recently used conversions are dropped once there are
+more than -cache-size megabytes of them and of the rendered pages below, 256
+by default. -no-cache converts and renders everything again and leaves the
+cache alone, for example after upgrading the markdown command.
+
+The output of pages is cached too, keyed by their text, their config, the
+template they are rendered with and the flags changing output, so a page none
+of them changed is copied from the cache instead of being rendered again.
+Pages whose templates show or link to other pages or files, like with
+.pages, renderPage, relref or readFile, or use .buildTime or .nonce, are
+always rendered, as are all pages with "imageDimensions" or "srcset" set or
+when Build is given middlewares. Pages that warned aren't cached, so they warn on every build.
+
+With "math" set in the config, $...$ and $$...$$ formulas are kept away from
+the markdown converter, outside of code. They end up wrapped as \(...\) and
+\[...\] for KaTeX or MathJax to render in the browser, or are rendered by the
+"mathCommand", for example "katex", which gets --display-mode for display
+math. The delimiters can be changed with "mathDelimiters", for example
+{"inline": ["\\(", "\\)"], "display": ["\\[", "\\]"]}.
+
+Templates can load scripts and styles only on the pages that need them:
+{{.uses.math}} is true for pages with formulas, and {{.uses.mermaid}},
+{{.uses.go}} and so on for pages with code blocks in that language.
+
+The converted HTML of a page can be post-processed before it is templated by
+listing built-in transforms under the "transforms" config key, for example
+["lazyImages", "headingAnchors", "externalLinksNewTab"]. They run in order,
+and not at all for text pages. "headingLinks" is "headingAnchors" with a
+clickable # link to each heading put in front of its text. "emoji" turns
+shortcodes like :rocket: into the emoji they name, in text only: not in
+code or in the attributes of tags.
+With "imageDimensions" set, images in the site that have no width and height
+get them from the image file, so the page doesn't jump around while they
+load. PNG, JPEG and GIF files are understood.
+With "srcset" set, like {"widths": [480, 960, 1440], "sizes": "(min-width:
+40em) 50vw, 100vw"}, local JPEG and PNG images in the content get a srcset of
+copies resized to each width smaller than the image, written next to it as
+photo-480w.jpg and so on, so browsers can pick what the screen needs. "sizes"
+defaults to 100vw and "quality", for JPEGs, to 75. Resized copies are kept in
+the -cache directory by the contents of the image, so only new or changed
+images are resized again. Images with a srcset of their own, SVGs and GIFs
+are left alone.
+With "namespaceFootnotes" set, the ids of footnotes get the name of their
+page in front, so pages shown together, like in a feed, keep their own
+footnotes.
+
+Files in the data directory of the site are read before building and given
+to every template as {{.data}}, keyed by file name: data/team.csv is
+{{.data.team}} and data/nav/main.json is {{.data.nav.main}}. JSON keeps its
+structure. CSV and TSV files become a list of rows, each a map from the
+column names in the first row to the values. Under "csv" in the config,
+"header": false makes every row a plain list instead, and "delimiter"
+changes the separator from comma or tab. The data directory is not copied
+to the output.
+
+Templates can embed data for scripts with {{toJSON .value}}, or {{siteJSON}}
+for the config keys listed under "exposeJSON". Nothing else is exposed.
+
+Builds are for the "dev" environment unless -env says otherwise; templates see
+it as {{.env}}. When a static file exists both as app.js and app.min.js,
+-env prod copies only the minified one and other builds only the readable
+one. The ".min" suffix can be changed with the "minSuffix" config key.
+Statics matching the patterns listed under "fingerprint" in the config, like
+["*.css", "*.js"], get part of the hash of their contents in their name,
+style.css becoming style.1a2b3c4d.css, so they can be cached forever. Links
+to them from src and href attributes in pages and templates are rewritten
+to match; templates can also look the names up in {{.fingerprints}}.
+Other CSS and JavaScript files can be minified while they are copied, by
+giving a command to pipe them through with -minify-css and -minify-js.
+References to source maps are kept, unless "stripSourceMaps" is set in the
+config, which also leaves the .map files out.
+Statics that are symlinks are copied as the file they point to, or the
+directory with everything in it, unless "symlinks" in the config is
+"preserve", which makes the same symlink in the output, or "skip", which
+leaves them out. A symlink to a directory it is in stops the build.
+
+Pages are written in UTF-8, unless "encoding" in the config or ---set
+encoding on a page names another one, like Shift_JIS, by any name browsers
+know it by. The output is then converted, failing on characters the
+encoding lacks, and a <meta charset> in the head is changed to match. The
+-serve server still labels HTML as UTF-8.
+
+Output is written exactly as the templates make it, whitespace and all.
+"trimTrailingWhitespace" in the config or on a page strips spaces and tabs
+from the ends of lines, except inside <pre>, and "insertFinalNewline" makes
+the output end in exactly one newline, as an .editorconfig would ask for.
+
+Pages with ---set amp true also get an AMP version, rendered with
+'amp.template' to name.amp.html. Its images become amp-img elements and
+style and event handler attributes are dropped. The AMP version finds the
+URL of the original in {{.canonical}}; the original links to it from its
+head with rel="amphtml".
+
+With -maintenance only 'maintenance.page' is built, written as index.html,
+together with the static files, for a coming soon or down for maintenance
+site. All other pages are left out.
+
+A page can choose its own output file with ---set outputPath, relative to
+the output directory, for example to write a CNAME file to the root. Two
+pages may not be written to the same file. Templates see the file the
+current page is written to as {{.outputFile}}, like dst/blog/post.html, and
+the path to link to it by as {{.url}}, like {{relURL}} would give it.
+
+Instead of following the layout of the src directory, output paths can
+follow a "permalinkPattern", like "/:year/:month/:slug/", which writes a page
+dated 2024-03-05 to 2024/03/my-post/index.html. The tokens are :year, :month
+and :day of the "date" of the page, which it then must have, its :slug, from
+"slug" or else its file name, and its :section. The pattern is set for all
+pages, for a page itself, or per section as a map like {"blog": "..."}, with
+"" for the pages in the root. Page bundles should use a pattern ending in a
+slash, as their resources stay in the directory of the bundle.
+
+With "autoIndex" set in the config, every directory that has pages but no
+index page gets one generated from 'list.template', which can iterate over
+the pages in that directory as {{.sectionPages}}. Pages know the top level
+directory they are in as {{.section}}.
+
+With -since-mtime a build records a hash of every source file in
+.static-state.json in the output directory. The next build with -since-mtime
+only renders the pages and copies the statics that changed since, along with
+the pages depending on what changed: the state also records the template each
+page is rendered with, the files it includes with ---code, and whether its
+template uses {{.data}}. Pages whose template can show or link to other
+pages, through {{.pages}}, renderPage, relref and the like, are rendered
+again on any change. A file a page was written to before and no page is
+written to now, as when it moved with ---set outputPath, is removed. When
+the config changed, a file was removed, a template was added or the
+environment is another one, everything is built again, as with -force.
+
+A ---source line is replaced by markdown downloaded from the URL after it.
+Downloads are kept in the -cache directory, .cache by default, and only
+fetched again with -refetch.
+
+A ---code line, like "---code ../main.go go", is replaced by a fenced code
+block holding that file, relative to the page, in the given language. With
+"---code ../main.go:10-20 go" only lines 10 to 20 are included.
+
+Long pages can be split into parts: "---set parts intro.md,usage.md" reads
+those files, relative to the page, right after the directive, in that order,
+as if they were written there, directives and all; a part that is read into
+itself, directly or through other parts, stops the build. Files that are
+only parts of pages can be kept out of the output with "ignore" in the
+config, a list of glob patterns like ["*.md", "drafts/*"]; patterns without
+a slash match the file name in any directory.
+
+Pages with ---set draft true are left out of the build. With -preview they
+are written to a separate directory instead, dst-preview by default or
+whatever -preview-dst says, together with the static files, so a preview can
+be shared without mixing drafts into the real output.
+
+A page can mark where its summary ends with <!--more-->, or whatever the
+"summaryDivider" config key says. Everything before it is the {{.excerpt}}
+of the page, for listings of other pages to show; the page itself still
+shows all of its {{.content}}.
+
+Every template gets the list of all pages as {{.pages}}, each with the values
+that page would render with, its {{.content}} included: every page is
+converted before any is rendered. The list is sorted by the numeric "weight"
+of each page (---set weight 10), lowest first, and then by name, so it is the
+same on every build. Setting "sortPagesBy" to "date" in the config sorts by the
+YYYY-MM-DD "date" of each page instead, newest first.
+
+Lists like {{.pages}} can be narrowed down in templates:
+{{range where .pages "section" "blog"}} keeps the pages in the blog section,
+{{first 5 .pages}} and {{after 5 .pages}} split the list, and
+{{sort .pages "title"}} or {{sort .pages "date" "desc"}} order it.
+{{range groupByDate "2006" .pages}} goes through the years that pages are
+dated in, newest first, with the year as {{.key}} and its pages as
+{{.pages}}. The same works on the rows of CSV data.
+
+Dates are formatted in other languages with {{dateFormatLang "2 January 2006"
+.date .lang}}, which gives "1 maart 2024" for a page with ---set lang nl.
+Without the last argument the "lang" of the site is used, or else English.
+It only knows the names of months and days in German, English, Spanish,
+French, Italian, Dutch and Portuguese; other languages stop the build.
+
+Counts read naturally with {{pluralize $n "post" "posts"}}, which gives the
+singular for 1, or 0 and 1 in French and Portuguese. {{numberFormat $n}}
+groups thousands the way the "lang" of the site does, as 1,234,567 or
+1.234.567, and {{numberFormat $n 2 .lang}} also rounds to 2 decimals in
+the language of the page. Both know the languages dateFormatLang knows.
+
+For a "what's new" page, {{.recentChanges}} lists the last commits that
+changed pages, newest first, when the src directory is in a git checkout.
+Each has a {{.hash}}, a {{.date}} like {{.date}} of pages, a {{.time}}, the
+{{.message}} and the names of the {{.pages}} it changed. There are 20 of them
+at most, or "recentChangesLimit" in the config; 0 leaves git alone.
+
+Output doesn't depend on the order Go happens to keep maps in: {{range}} over
+a map like {{.nav}} goes through it by key, and so do toJSON and siteJSON.
+{{sortedKeys .nav}} gives those keys as a list, and {{sortedMap .nav}} the
+entries, each with a {{.key}} and {{.value}}, for use with first, where and
+the like. Lists keep the order they are written in, in the config, JSON and
+CSV files alike; {{.pages}} is ordered as described above.
+
+Optional keys get a fallback with {{.subtitle | default "Welcome"}}, which
+takes a missing or empty value to be unset, but false and 0 not. With -strict
+a missing key is an error before default sees it, so themes that should work
+for any site use {{getOr "subtitle" "Welcome" .}} instead, which looks the key
+up in the page, or without the last argument in the config of the site.
+
+Links are made with {{relref . "blog/post"}}, relative to the current page,
+or with {{absURL "path"}} and {{relURL "path"}}, which are based on the
+"baseurl" config key, or the -baseurl flag when building somewhere else, like
+a deploy preview. The "trailingSlash" config key decides what they look
+like: "always" writes every page as name/index.html and links to name/,
+"never" links to name without .html and to directories without a slash.
+With "lowercaseURLs" set, pages are written to lowercased paths, About.page
+to about.html, for hosts that tell cases apart; links to them and
+{{.pages}} follow. Statics in directories with pages, like the resources of
+a bundle, are copied to the lowercased directory too, so links to them from
+the pages keep working; their file names, and other statics, stay as they
+are. Two pages whose names only differ in case, like About and about, then
+fail the build.
+{{if pageExists "about"}} tells whether the build has that page, so links to
+removed pages can be left out. Pages are named as for relref, or by the path
+they are written to, like "about.html" or "blog/".
+
+Static files are copied before any page is rendered. {{range files "downloads"}}
+iterates over the files in that directory of the output, each with a name,
+url, size and mtime. {{sri "app.js"}} gives the subresource integrity value
+of a shipped file, under its fingerprinted name if it has one.
+{{readFile "icons/logo.svg" | safeHTML}} inlines a file from the src
+directory, or from the directory "readFileDir" in the config names relative
+to it; paths can't reach outside of that directory.
+
+With "feed" set in the config, an Atom feed of all pages with a "date" is
+written to feed.xml, newest first, using the "title" and "author" config
+keys. The top level directories listed under "feedSections", for example
+["blog"], get a feed of just their own pages in blog/feed.xml. Feeds link to
+the pages by "baseurl".
+
+With "robots" set in the config, to true or to something like
+{"disallow": ["/drafts/"], "allow": ["/"]}, a robots.txt is written. Only
+-env prod builds get those rules and a pointer to any sitemap.xml; other
+builds disallow everything, so previews are not indexed.
+
+For hosts like Netlify, a _headers file is written from the "headers" config
+key, mapping paths to the headers to send for them:
+
+	"headers": {"/assets/*": {"Cache-Control": "max-age=31536000"}}
+
+A page adds headers for itself with "headers" in its data file, or as
+"Name: value" lines in a ---setblock headers.
+
+For a Content-Security-Policy with nonces, set "nonceScope" in the config to
+"build" for one random nonce per build, or to "page" for one per page.
+Templates see it as {{.nonce}}, for <script nonce="{{.nonce}}">, and {nonce}
+in header values is replaced by it: by the nonce of the build in the headers
+of the config, and by that of the page in its own. As the nonce changes with
+every build, -verify will report every page using it.
+
+With -text-mirror the source text of every page is also written below txt/
+in the output, as txt/blog/post.txt for blog/post, with an llms.txt in the
+root linking to all of them. HTML pages get their tags stripped. Pages with
+---set noindex true are left out.
+
+With -singlepage handbook.html the content of all pages, in the order of
+{{.pages}}, is also written to that one file in the output, for reading
+offline or printing. It is rendered with singlepage.template, or the
+"singlePageTemplate" config key, which gets every page as a section in
+{{.sections}}, with its name, title, anchor and content, and all of them
+stitched together as {{.content}}. Ids are prefixed with the anchor of their
+page, and links between pages point to their sections instead.
+{{.printMode}} is true in it and false everywhere else, so a template used
+for both, like the default one, can leave out navigation, search and other
+interactive parts, or add a print stylesheet, with {{if .printMode}}.
+
+A template can include another page rendered through its own template with
+{{renderPage "blog/latest"}}; give that page a fragment template with
+---settemplate to embed just its content. Pages may not embed themselves,
+directly or through other pages.
+
+If the src directory contains a 'config.schema.json', the config is validated
+against it before building. Only a subset of JSON Schema is understood: type,
+enum, pattern, properties, required, additionalProperties and items.
+
+Several sites sharing a theme can be built in one go with -sites sites.json:
+
+	{
+		"templates": "theme",
+		"config": {"author": "Me"},
+		"sites": [
+			{"src": "one/src", "dst": "one/dst"},
+			{"src": "two/src", "dst": "two/dst", "config": {"title": "Two"}}
+		]
+	}
+
+Paths are relative to the sites file. The templates are parsed once. Each
+site starts from the shared config, then gets its own config.json, if it has
+one, and then the overrides listed with it.
+
+-lint reports common mistakes after building: pages without a ---set title
+of their own, images without alt text, pages without content, pages with
+URLs that only differ in case or punctuation and keys set for a page that
+no template uses. These are warnings, unless -strict is given too.
+
+-orphans warns about statics that nothing in the output links to, once the
+site is built, so assets that are no longer used can be found and removed.
+Links are looked for in the src, href and srcset attributes of pages and
+feeds and in the url()s of stylesheets. Statics that are meant to be found
+without a link, like favicon.ico, can be listed under "allowOrphans", which
+takes patterns like "ignore" does. With -Werror orphans fail the build.
+
+-Werror turns every warning of a build, from -lint or otherwise, like raw
+HTML omitted from markdown or a ---setblock without its ---endblock, into a
+failure for CI. The build still reports them all, then says how many there
+were and exits with an error before recording its state or, with -atomic,
+replacing the output. Warnings and other problems, like a failed rebuild
+with -watch-config, go to stderr, the other messages to stdout; with
+-timestamps all of them have the time in front.
+
+To check that a site's output doesn't change between builds of the same
+sources, for example because of map order leaking into a template, run with
+-verify. It builds twice into temporary directories, without the cache of
+converted markdown and rendered pages, lists the files that differ and fails
+if there are any. Nothing is written to the dst directory.
+
+Tools that only need to know which pages there are can run static with
+-metadata, which prints every page with its name, source, URL and the values
+it sets with ---set or its data file, as JSON. Only the directives are read,
+so it is fast even for large sites: nothing is converted, fetched or
+rendered. Values set with ---setmarkdownblock are given as markdown, and
+---source and ---code are skipped, so the markdown command isn't needed.
+
+With -serve the output is served on http://localhost:8080/ once it is built,
+or on the port given with -port. If that is taken, -port-auto picks a free
+one instead, unless -port was given; the URL is printed either way. Like
+hosts with clean URLs, it serves about.html for /about, so links made with
+"trailingSlash": "never" work. Ctrl-C stops the server cleanly, after the
+requests it is answering.
+With -watch-config too, the whole site is rebuilt whenever config.json or
+config.schema.json change, as a change to either can affect every page. The
+render cache is cleared first. A rebuild that fails is reported, and the
+server keeps running; Ctrl-C lets a rebuild in progress finish first. Other
+files aren't watched, so changing pages still means running static again.
+
+To find out where a build spends its time, run it with -cpuprofile cpu.prof
+and/or -memprofile mem.prof and inspect the result with
+
+	go tool pprof -top static cpu.prof
+
+Time spent waiting on the markdown command shows up in os/exec, template
+execution in text/template, and file IO in os and io. The profiles are
+written when static is done, also when the build fails; with -serve that is
+once the server is stopped, so they cover serving and any -watch-config
+rebuilds as well.
 */
-package main
+package static
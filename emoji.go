@@ -0,0 +1,125 @@
+package static
+
+import (
+	"bytes"
+	"regexp"
+)
+
+var (
+	emojiRe = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+	// Code, scripts and styles, and the tags themselves, with their attributes
+	notTextRe = regexp.MustCompile(`(?s)<pre\b.*?</pre>|<code\b.*?</code>|<script\b.*?</script>|<style\b.*?</style>|<[^>]*>`)
+)
+
+// The shortcodes understood by the emoji transform, named as on GitHub
+var emojiCodes = map[string]string{
+	"+1":                   "👍",
+	"-1":                   "👎",
+	"100":                  "💯",
+	"airplane":             "✈️",
+	"alarm_clock":          "⏰",
+	"apple":                "🍎",
+	"art":                  "🎨",
+	"beer":                 "🍺",
+	"bell":                 "🔔",
+	"bike":                 "🚲",
+	"book":                 "📖",
+	"books":                "📚",
+	"boom":                 "💥",
+	"bow":                  "🙇",
+	"brain":                "🧠",
+	"bug":                  "🐛",
+	"bulb":                 "💡",
+	"cake":                 "🍰",
+	"calendar":             "📆",
+	"camera":               "📷",
+	"cat":                  "🐱",
+	"champagne":            "🍾",
+	"clap":                 "👏",
+	"coffee":               "☕",
+	"computer":             "💻",
+	"confused":             "😕",
+	"construction":         "🚧",
+	"cry":                  "😢",
+	"dog":                  "🐶",
+	"email":                "📧",
+	"exclamation":          "❗",
+	"eyes":                 "👀",
+	"fire":                 "🔥",
+	"gift":                 "🎁",
+	"globe_with_meridians": "🌐",
+	"grin":                 "😁",
+	"grinning":             "😀",
+	"hammer":               "🔨",
+	"heart":                "❤️",
+	"heavy_check_mark":     "✔️",
+	"hourglass":            "⌛",
+	"house":                "🏠",
+	"information_source":   "ℹ️",
+	"joy":                  "😂",
+	"key":                  "🔑",
+	"laughing":             "😆",
+	"link":                 "🔗",
+	"lock":                 "🔒",
+	"mag":                  "🔍",
+	"memo":                 "📝",
+	"moon":                 "🌙",
+	"muscle":               "💪",
+	"musical_note":         "🎵",
+	"no_entry":             "⛔",
+	"ok_hand":              "👌",
+	"package":              "📦",
+	"pencil":               "📝",
+	"pizza":                "🍕",
+	"point_right":          "👉",
+	"pray":                 "🙏",
+	"question":             "❓",
+	"rainbow":              "🌈",
+	"raised_hands":         "🙌",
+	"recycle":              "♻️",
+	"rocket":               "🚀",
+	"rotating_light":       "🚨",
+	"see_no_evil":          "🙈",
+	"shrug":                "🤷",
+	"smile":                "😄",
+	"smiley":               "😃",
+	"snowflake":            "❄️",
+	"sob":                  "😭",
+	"sparkles":             "✨",
+	"star":                 "⭐",
+	"sunglasses":           "😎",
+	"sunny":                "☀️",
+	"tada":                 "🎉",
+	"thinking":             "🤔",
+	"thumbsdown":           "👎",
+	"thumbsup":             "👍",
+	"trophy":               "🏆",
+	"umbrella":             "☔",
+	"warning":              "⚠️",
+	"wave":                 "👋",
+	"white_check_mark":     "✅",
+	"wink":                 "😉",
+	"wrench":               "🔧",
+	"x":                    "❌",
+	"zap":                  "⚡",
+}
+
+// emoji replaces :name: shortcodes in the text of the HTML by their emoji,
+// not in code or inside tags, like a title="a:b:c" attribute. Unknown names
+// are left as they are.
+func emoji(b []byte) []byte {
+	var out bytes.Buffer
+	for _, s := range splitCode(b, notTextRe) {
+		if s.code {
+			out.Write(s.text)
+			continue
+		}
+		out.Write(emojiRe.ReplaceAllFunc(s.text, func(m []byte) []byte {
+			if e, ok := emojiCodes[string(m[1:len(m)-1])]; ok {
+				return []byte(e)
+			}
+			return m
+		}))
+	}
+	return out.Bytes()
+}
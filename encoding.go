@@ -0,0 +1,46 @@
+package static
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// The charset declared by <meta charset="utf-8"> and its http-equiv form
+var metaCharsetRe = regexp.MustCompile(`(?i)(<meta\b[^>]*\bcharset\s*=\s*["']?)utf-8`)
+
+// outputEncoding returns the encoding the page asks to be written in with
+// "encoding", like "Shift_JIS", or "" for UTF-8.
+func outputEncoding(c config) string {
+	enc := configString(c, "encoding", "")
+	if strings.EqualFold(enc, "utf-8") || strings.EqualFold(enc, "utf8") {
+		return ""
+	}
+	return enc
+}
+
+// lookupEncoding returns the encoding named enc, by any of the labels
+// browsers know it by.
+func lookupEncoding(enc string) encoding.Encoding {
+	e, err := htmlindex.Get(enc)
+	if err != nil {
+		fatal("Unknown encoding " + enc + ".")
+	}
+	return e
+}
+
+// encode transcodes the output of the page name from UTF-8 to enc.
+// Characters enc can't represent are an error rather than silently dropped.
+// The charset declared in the head of HTML pages is changed to match.
+func encode(name string, b []byte, enc string, html bool) []byte {
+	if html {
+		b = metaCharsetRe.ReplaceAll(b, []byte("${1}"+enc))
+	}
+	out, err := lookupEncoding(enc).NewEncoder().Bytes(b)
+	if err != nil {
+		fatal("Encoding " + name + " as " + enc + ": " + err.Error())
+	}
+	return out
+}
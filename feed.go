@@ -0,0 +1,117 @@
+package static
+
+import (
+	"encoding/xml"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const feedFile = "feed.xml"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// writeFeeds writes an Atom feed of the dated pages of the whole site to
+// feed.xml, if "feed" is set in the config, and one of each section listed
+// under "feedSections" to section/feed.xml.
+func writeFeeds(pages map[string]*page, dstdir string, config config) {
+	if configBool(config, "feed") {
+		writeFeed(pages, "", dstdir, config)
+	}
+	for _, section := range configList(config, "feedSections") {
+		writeFeed(pages, section, dstdir, config)
+	}
+}
+
+// writeFeed writes the feed of the pages in section, or of all pages if
+// section is empty. Pages without a "date" are not in any feed.
+func writeFeed(pages map[string]*page, section string, dstdir string, config config) {
+	var dated []*page
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		if p.draft || p.src == "" || p.variant || configDate(p.config, "date").IsZero() {
+			continue
+		}
+		if section != "" && pageSection(name) != section {
+			continue
+		}
+		dated = append(dated, p)
+	}
+	sort.SliceStable(dated, func(i, j int) bool {
+		return configDate(dated[i].config, "date").After(configDate(dated[j].config, "date"))
+	})
+
+	rel := path.Join(section, feedFile)
+	f := atomFeed{
+		Title: configString(config, "title", ""),
+		ID:    absURL(config, rel),
+		Link:  atomLink{Href: absURL(config, ""), Rel: "alternate"},
+	}
+	if section != "" {
+		f.Title += " - " + section
+		f.Link.Href = absURL(config, applySlash(section+"/", configString(config, "trailingSlash", "")))
+	}
+	if author := configString(config, "author", ""); author != "" {
+		f.Author = &atomAuthor{author}
+	}
+	for _, p := range dated {
+		entry := feedEntry(p, config)
+		if f.Updated == "" {
+			f.Updated = entry.Updated
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	if f.Updated == "" {
+		f.Updated = time.Time{}.Format(time.RFC3339)
+	}
+
+	b, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	say("    " + rel)
+	writeFile(filepath.Join(dstdir, filepath.FromSlash(rel)), append([]byte(xml.Header), append(b, '\n')...))
+}
+
+// feedEntry describes p for a feed, with the content preparePages filled in.
+func feedEntry(p *page, config config) atomEntry {
+	u := absURL(config, linkURL(p.url, configString(config, "trailingSlash", "")))
+	return atomEntry{
+		Title:   configString(p.config, "title", p.name),
+		ID:      u,
+		Link:    atomLink{Href: u},
+		Updated: configDate(p.config, "date").Format(time.RFC3339),
+		Content: atomContent{Type: "html", Body: configString(p.config, "content", "")},
+	}
+}
@@ -0,0 +1,49 @@
+package static
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var cacheDir = Flags.String("cache", ".cache", "directory to keep downloaded and generated files between builds")
+var fetchTimeout = Flags.Duration("fetch-timeout", 10*time.Second, "how long downloading a ---source may take")
+var refetch = Flags.Bool("refetch", false, "download every ---source again instead of using the cache")
+
+// fetchSource returns the contents of url, for the page called name. Once
+// downloaded it is kept in the cache, so later builds don't need the network.
+func fetchSource(name string, url string) []byte {
+	cached := filepath.Join(*cacheDir, "sources", fmt.Sprintf("%x", sha256.Sum256([]byte(url))))
+	if !*refetch {
+		if b, err := ioutil.ReadFile(cached); err == nil {
+			return b
+		}
+	}
+
+	sayPage(name, "Fetching "+url)
+	client := http.Client{Timeout: *fetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		fatal("Fetching source of " + name + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fatal("Fetching source of " + name + ": " + url + ": " + resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		fatal("Fetching source of " + name + ": " + err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		fatal(err)
+	}
+	if err := ioutil.WriteFile(cached, b, 0644); err != nil {
+		fatal(err)
+	}
+	return b
+}
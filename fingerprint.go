@@ -0,0 +1,84 @@
+package static
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var assetRefRe = regexp.MustCompile(`\b(src|href)(\s*=\s*["'])([^"']*)(["'])`)
+
+// fingerprints returns the output paths, as given by staticOutputPaths, of
+// the statics matching the patterns under "fingerprint" in the config, like
+// ["*.css", "*.js"], mapped to the name they are shipped under, which has
+// part of the hash of their contents in it: style.css becomes
+// style.1a2b3c4d.css. Patterns without a slash match the file name in any
+// directory. Paths are relative to srcdir, with forward slashes.
+func fingerprints(srcdir string, statics []string, outputs map[string]string, config config) map[string]string {
+	patterns := configList(config, "fingerprint")
+	names := make(map[string]string)
+	if len(patterns) == 0 {
+		return names
+	}
+	for _, rel := range statics {
+		rel = filepath.ToSlash(rel)
+		if !matchesName(patterns, rel) {
+			continue
+		}
+		b, err := readSrcFile(filepath.Join(srcdir, filepath.FromSlash(rel)))
+		if err != nil {
+			fatal(err)
+		}
+		hash := fmt.Sprintf("%x", sha256.Sum256(b))[:8]
+		out := outputs[rel]
+		ext := path.Ext(out)
+		names[out] = strings.TrimSuffix(out, ext) + "." + hash + ext
+	}
+	return names
+}
+
+// matchesName reports whether the slash separated path rel matches one of
+// the patterns, matching just the file name for patterns without a slash.
+func matchesName(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteAssetRefs points the src and href attributes in the HTML of the
+// page at the output path from to the fingerprinted names of the files they
+// refer to. Only links within the site are rewritten.
+func rewriteAssetRefs(b []byte, from string, c config) []byte {
+	names, _ := c["fingerprints"].(map[string]string)
+	if len(names) == 0 {
+		return b
+	}
+	return assetRefRe.ReplaceAllFunc(b, func(attr []byte) []byte {
+		m := assetRefRe.FindSubmatch(attr)
+		u, err := url.Parse(string(m[3]))
+		if err != nil {
+			return attr
+		}
+		rel, ok := localPath(u, from, c)
+		if !ok {
+			return attr
+		}
+		hashed, ok := names[rel]
+		if !ok {
+			return attr
+		}
+		u.Path = path.Join(path.Dir(u.Path), path.Base(hashed))
+		return []byte(string(m[1]) + string(m[2]) + u.String() + string(m[4]))
+	})
+}
@@ -0,0 +1,222 @@
+package static
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs returns the functions available to every template.
+func templateFuncs(c config) template.FuncMap {
+	funcs := template.FuncMap{
+		"toJSON":         toJSON,
+		"where":          where,
+		"first":          first,
+		"after":          after,
+		"sort":           sortBy,
+		"groupByDate":    groupByDate,
+		"sortedKeys":     sortedKeys,
+		"sortedMap":      sortedMap,
+		"safeHTML":       safeHTML,
+		"dateFormatLang": dateFormatLang(c),
+		"pluralize":      pluralize(c),
+		"numberFormat":   numberFormat(c),
+		"default":        defaultValue,
+		"getOr": func(key string, def interface{}, from ...config) interface{} {
+			in := c
+			if len(from) > 0 {
+				in = from[0]
+			}
+			return defaultValue(def, in[key])
+		},
+		"absURL": func(u string) string {
+			return absURL(c, u)
+		},
+		"relURL": func(u string) string {
+			return relURL(c, u)
+		},
+		"siteJSON": func() (string, error) {
+			// Only expose what the config explicitly allows
+			site := make(map[string]interface{})
+			for _, k := range configList(c, "exposeJSON") {
+				if v, ok := c[k]; ok {
+					site[k] = v
+				}
+			}
+			return toJSON(site)
+		},
+	}
+	// Parsing only needs the names; processPages fills these in once all
+	// pages are known.
+	for name := range pageFuncs(nil, nil, "", "", nil) {
+		funcs[name] = unavailable(name)
+	}
+	return funcs
+}
+
+func unavailable(name string) func() (string, error) {
+	return func() (string, error) {
+		return "", errors.New(name + " is not available here")
+	}
+}
+
+// pageFuncs returns the template functions that need to know about all
+// pages of the site, about its output in dstdir, or about the files in
+// filesdir that templates may read.
+func pageFuncs(pages map[string]*page, templates map[string]*template.Template, filesdir string, dstdir string, c config) template.FuncMap {
+	return template.FuncMap{
+		"renderPage": renderPageFunc(pages, templates, nil),
+		"pageExists": func(ref string) bool {
+			_, ok := findPage(pages, ref)
+			return ok
+		},
+		"relref": func(from config, to string) (string, error) {
+			name, _ := from["name"].(string)
+			src, ok := pages[name]
+			if !ok {
+				return "", fmt.Errorf("relref: page %s not found", name)
+			}
+			dst, ok := pages[to]
+			if !ok {
+				return "", fmt.Errorf("relref: page %s not found", to)
+			}
+			return relativeURL(src.url, dst.url, configString(src.config, "trailingSlash", "")), nil
+		},
+		"files": func(dir string) ([]config, error) {
+			return listOutputFiles(dstdir, dir)
+		},
+		"sri": func(file string) (string, error) {
+			names, _ := c["fingerprints"].(map[string]string)
+			return integrity(dstdir, file, names)
+		},
+		"readFile": func(file string) (string, error) {
+			b, err := readSrcFile(filepath.Join(filesdir, filepath.FromSlash(path.Clean("/"+file))))
+			return string(b), err
+		},
+	}
+}
+
+// renderPageFunc returns renderPage for templates rendering the pages in
+// embedding, the outermost first, which can't be rendered again from there.
+// Each page renderPage renders gets one knowing it, not a flag on the page,
+// as other pages may be rendering it at the same time.
+func renderPageFunc(pages map[string]*page, templates map[string]*template.Template, embedding []string) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		p, ok := pages[name]
+		if !ok {
+			return "", fmt.Errorf("page %s not found", name)
+		}
+		for _, n := range embedding {
+			if n == name {
+				return "", fmt.Errorf("page %s embeds itself", name)
+			}
+		}
+		inner := append(append([]string(nil), embedding...), name)
+		funcs := template.FuncMap{"renderPage": renderPageFunc(pages, templates, inner)}
+		return string(p.render(templates, funcs)), nil
+	}
+}
+
+// findPage looks up the page ref refers to, either by name, as in
+// "blog/post", or by the path it is written to or linked to, as in
+// "blog/post.html", "/blog/post/" or "blog/" for blog/index.
+func findPage(pages map[string]*page, ref string) (*page, bool) {
+	if p, ok := pages[ref]; ok {
+		return p, true
+	}
+	name := strings.TrimPrefix(ref, "/")
+	switch {
+	case name == "" || strings.HasSuffix(name, "/"):
+		name += "index"
+	case strings.HasSuffix(name, ".html"):
+		name = strings.TrimSuffix(name, ".html")
+	}
+	if p, ok := pages[name]; ok {
+		return p, true
+	}
+	// A page written as name/index.html with "trailingSlash" set
+	if p, ok := pages[strings.TrimSuffix(name, "/index")]; ok {
+		return p, true
+	}
+	// A directory linked to without a slash
+	p, ok := pages[name+"/index"]
+	return p, ok
+}
+
+// listOutputFiles describes the files in the subdirectory dir of dstdir, for
+// templates to iterate over.
+func listOutputFiles(dstdir string, dir string) ([]config, error) {
+	dir = path.Clean("/" + dir)[1:]
+	infos, err := ioutil.ReadDir(filepath.Join(dstdir, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil, err
+	}
+	var files []config
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		files = append(files, config{
+			"name":  info.Name(),
+			"url":   path.Join(dir, info.Name()),
+			"size":  info.Size(),
+			"mtime": info.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+// integrity returns the subresource integrity value of file in dstdir, as
+// shipped: under its fingerprinted name in names, if it has one.
+func integrity(dstdir string, file string, names map[string]string) (string, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+file), "/")
+	if hashed, ok := names[rel]; ok {
+		rel = hashed
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dstdir, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", err
+	}
+	sum := sha512.Sum384(b)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// defaultValue returns v, or def if v is missing or empty, as in
+// {{.subtitle | default "Welcome"}}. False and 0 count as set.
+func defaultValue(def interface{}, v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return def
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if rv.Len() == 0 {
+			return def
+		}
+	}
+	return v
+}
+
+// safeHTML marks s as HTML to embed as is. Templates don't escape anything,
+// so it returns s unchanged; it only makes the intent of the template clear.
+func safeHTML(s string) string {
+	return s
+}
+
+// toJSON marshals v so that it can be embedded in a <script> element. The
+// encoder escapes <, > and & (and U+2028/U+2029), so the output can never
+// close the element or start a comment.
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
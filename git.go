@@ -0,0 +1,94 @@
+package static
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var since = Flags.String("since", "", "only rebuild pages changed since this git ref")
+
+// changedPages asks git which files in dir changed since ref. It returns the
+// set of changed paths, which processPages adds the pages depending on them
+// to, or nil if everything should be rebuilt, either because a template or
+// the config changed or because git couldn't tell us.
+func changedPages(dir string, ref string) map[string]bool {
+	cmd := exec.Command("git", "-C", dir, "diff", "--name-only", "--relative", ref)
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	if err := cmd.Run(); err != nil {
+		say("Could not get changes from git, doing a full build: " + err.Error())
+		return nil
+	}
+
+	pages := make(map[string]bool)
+	for _, name := range strings.Split(b.String(), "\n") {
+		switch {
+		case strings.HasSuffix(name, ".template"), name == configFile:
+			say("Changed " + name + ", doing a full build.")
+			return nil
+		case strings.HasSuffix(name, *pageExt+".json"):
+			pages[filepath.Join(dir, strings.TrimSuffix(name, ".json"))] = true
+		case name != "":
+			pages[filepath.Join(dir, name)] = true
+		}
+	}
+	return pages
+}
+
+// gitVersion returns the short commit hash of the checkout dir is in, or
+// "unknown" if there is none.
+func gitVersion(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// recentChanges returns the last limit commits that touched pages in dir,
+// newest first, for a "what's new" page: each with its hash, date,
+// time, message and the names of the pages it changed. Without git, or
+// outside of a checkout, there are none.
+func recentChanges(dir string, limit int) []config {
+	if limit <= 0 {
+		return nil
+	}
+	cmd := exec.Command("git", "-C", dir, "log", "-n", strconv.Itoa(limit), "--relative", "--name-only",
+		"--format=%x00%H%x1f%aI%x1f%s", "--", "*"+*pageExt, "*"+*pageExt+".json")
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+
+	var changes []config
+	for _, entry := range strings.Split(b.String(), "\x00")[1:] {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		fields := strings.SplitN(lines[0], "\x1f", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339, fields[1])
+		var pages []string
+		seen := make(map[string]bool)
+		for _, name := range lines[1:] {
+			name = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(name), ".json"), *pageExt)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				pages = append(pages, name)
+			}
+		}
+		changes = append(changes, config{
+			"hash":    fields[0],
+			"date":    t.Format(dateLayout),
+			"time":    t,
+			"message": fields[2],
+			"pages":   pages,
+		})
+	}
+	return changes
+}
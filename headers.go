@@ -0,0 +1,77 @@
+package static
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The file static hosts like Netlify and Cloudflare Pages read headers from
+const headersFile = "_headers"
+
+// writeHeaders writes the _headers file from the "headers" config key,
+// mapping paths, which may contain *, to headers and their values. Pages
+// add their own with "headers", either in their data file or as lines like
+// "X-Frame-Options: DENY" in a ---setblock. {nonce} in a value becomes the
+// nonce of the build, or of the page for its own headers. Nothing is written
+// if there are no headers at all.
+func writeHeaders(pages map[string]*page, dstdir string, config config) {
+	var out bytes.Buffer
+	site := configMap(config, "headers")
+	paths := make([]string, 0, len(site))
+	for p := range site {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		writeHeaderRules(&out, p, withNonce(headerValues(site[p]), configString(config, "nonce", "")))
+	}
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		if p.draft || p.src == "" || p.variant {
+			continue
+		}
+		// Without headers of its own a page sees those of the site
+		if hasKey(p.keys, "headers") {
+			writeHeaderRules(&out, configString(p.config, "url", ""), withNonce(headerValues(p.config["headers"]), configString(p.config, "nonce", "")))
+		}
+	}
+	if out.Len() == 0 {
+		return
+	}
+	say("    " + headersFile)
+	writeFile(filepath.Join(dstdir, headersFile), out.Bytes())
+}
+
+func writeHeaderRules(out *bytes.Buffer, path string, headers map[string]string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out.WriteString(path + "\n")
+	for _, name := range names {
+		out.WriteString("  " + name + ": " + headers[name] + "\n")
+	}
+}
+
+// headerValues reads headers given as a map, or as "Name: value" lines.
+func headerValues(v interface{}) map[string]string {
+	headers := make(map[string]string)
+	switch v := v.(type) {
+	case string:
+		for _, line := range strings.Split(v, "\n") {
+			if i := strings.Index(line, ":"); i > 0 {
+				headers[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	default:
+		for name, value := range configMap(config{"headers": v}, "headers") {
+			if s, ok := value.(string); ok {
+				headers[name] = s
+			}
+		}
+	}
+	return headers
+}
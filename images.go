@@ -0,0 +1,56 @@
+package static
+
+import (
+	"fmt"
+	"image"
+	// The formats image.DecodeConfig understands
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+var imgSrcRe = regexp.MustCompile(`\bsrc\s*=\s*["']([^"']*)["']`)
+
+// addImageDimensions gives the local images in the HTML of the page at the
+// output path from, below the output directory root, the width and height
+// attributes they are missing, so browsers can keep room for them while
+// they load. SVGs, images on other sites and images in formats Go can't
+// read are left alone.
+func addImageDimensions(b []byte, root string, from string, c config) []byte {
+	names, _ := c["fingerprints"].(map[string]string)
+	return imgRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		if widthRe.Match(tag) || heightRe.Match(tag) {
+			return tag
+		}
+		m := imgSrcRe.FindSubmatch(tag)
+		if m == nil {
+			return tag
+		}
+		u, err := url.Parse(string(m[1]))
+		if err != nil {
+			return tag
+		}
+		rel, ok := localPath(u, from, c)
+		if !ok || path.Ext(rel) == ".svg" {
+			return tag
+		}
+		if hashed, ok := names[rel]; ok {
+			rel = hashed
+		}
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return tag
+		}
+		defer f.Close()
+		ic, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return tag
+		}
+		return addAttr(tag, fmt.Sprintf(`width="%d" height="%d"`, ic.Width, ic.Height))
+	})
+}
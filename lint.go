@@ -0,0 +1,190 @@
+package static
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"text/template"
+	"text/template/parse"
+)
+
+var lint = Flags.Bool("lint", false, "report common authoring mistakes in the pages after building, failing with -strict")
+
+var altRe = regexp.MustCompile(`\balt\s*=`)
+
+// Keys static itself reads from pages, which don't need a template to use
+// them
+var builtinKeys = map[string]bool{
+	"amp":                    true,
+	"date":                   true,
+	"defaultTemplate":        true,
+	"draft":                  true,
+	"encoding":               true,
+	"format":                 true,
+	"headers":                true,
+	"imageDimensions":        true,
+	"insertFinalNewline":     true,
+	"markdown":               true,
+	"markdownUnsafe":         true,
+	"math":                   true,
+	"mathCommand":            true,
+	"mathDelimiters":         true,
+	"namespaceFootnotes":     true,
+	"noindex":                true,
+	"outputPath":             true,
+	"parts":                  true,
+	"permalinkPattern":       true,
+	"slug":                   true,
+	"srcset":                 true,
+	"summaryDivider":         true,
+	"templateFallbacks":      true,
+	"title":                  true,
+	"trailingSlash":          true,
+	"transforms":             true,
+	"trimTrailingWhitespace": true,
+	"weight":                 true,
+}
+
+// lintPages warns about pages without a title of their own, images without
+// alt text, pages without content, pages whose URLs only differ in case or
+// punctuation, and keys set for the page that no template uses. With -strict
+// any of these stops the build.
+func lintPages(pages map[string]*page, templates map[string]*template.Template) {
+	say("Linting pages.")
+	used := templateFields(templates)
+	slugs := make(map[string]string)
+	problems := 0
+	warn := func(name string, msg string) {
+		warnPage(name, msg)
+		problems++
+	}
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		if p.src == "" || p.variant {
+			continue
+		}
+		if !hasKey(p.keys, "title") {
+			warn(name, "no title of its own")
+		}
+		if len(bytes.TrimSpace(p.body)) == 0 {
+			warn(name, "no content")
+		}
+		if n := imagesWithoutAlt(p.render(templates, nil)); n > 0 {
+			warn(name, strconv.Itoa(n)+" images without alt text")
+		}
+		slug := slugify(p.url)
+		if other, ok := slugs[slug]; ok {
+			warn(name, "URL too much like the one of "+other)
+		}
+		slugs[slug] = name
+		for _, key := range p.keys {
+			if !used[key] && !builtinKeys[key] {
+				warn(name, key+" is set but not used by any template")
+			}
+		}
+	}
+	if problems > 0 && *strict {
+		fatal("Linting found " + strconv.Itoa(problems) + " problems.")
+	}
+}
+
+func imagesWithoutAlt(b []byte) int {
+	n := 0
+	for _, img := range imgRe.FindAll(b, -1) {
+		if !altRe.Match(img) {
+			n++
+		}
+	}
+	return n
+}
+
+func hasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFields returns the names of all fields used in templates, as in
+// {{.title}} or {{.author.name}}. Which data they are used on doesn't
+// matter.
+func templateFields(templates map[string]*template.Template) map[string]bool {
+	fields := make(map[string]bool)
+	for _, t := range templates {
+		for name := range templateNames(t) {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// templateNames returns the names of the fields and functions t and the
+// templates it defines use, and the strings it passes, which may be keys
+// as in {{index . "title"}}.
+func templateNames(t *template.Template) map[string]bool {
+	names := make(map[string]bool)
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.FieldNode:
+			for _, f := range n.Ident {
+				names[f] = true
+			}
+		case *parse.ChainNode:
+			for _, f := range n.Field {
+				names[f] = true
+			}
+			walk(n.Node)
+		case *parse.VariableNode:
+			for _, f := range n.Ident[1:] {
+				names[f] = true
+			}
+		case *parse.IdentifierNode:
+			names[n.Ident] = true
+		case *parse.IfNode:
+			walkBranch(&n.BranchNode, walk)
+		case *parse.RangeNode:
+			walkBranch(&n.BranchNode, walk)
+		case *parse.WithNode:
+			walkBranch(&n.BranchNode, walk)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.StringNode:
+			names[n.Text] = true
+		}
+	}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			walk(tt.Tree.Root)
+		}
+	}
+	return names
+}
+
+func walkBranch(b *parse.BranchNode, walk func(parse.Node)) {
+	walk(b.Pipe)
+	walk(b.List)
+	walk(b.ElseList)
+}
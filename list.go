@@ -0,0 +1,83 @@
+package static
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+var list = Flags.Bool("list", false, "list the pages, templates, statics and config keys instead of building")
+var listJSON = Flags.Bool("json", false, "print the -list output as JSON")
+
+type listing struct {
+	Pages     []listedPage `json:"pages"`
+	Templates []string     `json:"templates"`
+	Statics   []string     `json:"statics"`
+	Config    []string     `json:"config"`
+}
+
+type listedPage struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Template string `json:"template"`
+	Output   string `json:"output"`
+	Draft    bool   `json:"draft,omitempty"`
+}
+
+// listSite prints what a build of srcdir would work with.
+func listSite(srcdir string, dstdir string, config config, templates map[string]*template.Template) {
+	var l listing
+	pages := readPages(srcdir, dstdir, config, true)
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		tname := p.templateName(templates)
+		_, used := lookupTemplate(tname, p.config, templates)
+		if used == "" {
+			used = tname + " (missing)"
+		}
+		l.Pages = append(l.Pages, listedPage{name, p.src, used, p.dst, p.draft})
+	}
+	for name := range templates {
+		l.Templates = append(l.Templates, name)
+	}
+	sort.Strings(l.Templates)
+	for _, rel := range listStatics(srcdir, config) {
+		l.Statics = append(l.Statics, filepath.ToSlash(rel))
+	}
+	for key := range config {
+		l.Config = append(l.Config, key)
+	}
+	sort.Strings(l.Config)
+
+	if *listJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(l); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	fmt.Println("Pages:")
+	for _, p := range l.Pages {
+		draft := ""
+		if p.Draft {
+			draft = " (draft)"
+		}
+		fmt.Printf("    %s%s: %s -> %s using %s\n", p.Name, draft, p.Source, p.Output, p.Template)
+	}
+	fmt.Println("Templates:")
+	for _, t := range l.Templates {
+		fmt.Println("    " + t)
+	}
+	fmt.Println("Statics:")
+	for _, s := range l.Statics {
+		fmt.Println("    " + s)
+	}
+	fmt.Println("Config keys:")
+	for _, k := range l.Config {
+		fmt.Println("    " + k)
+	}
+}
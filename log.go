@@ -0,0 +1,86 @@
+package static
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var timestamps = Flags.Bool("timestamps", false, "prefix build messages with the time")
+var werror = Flags.Bool("Werror", false, "fail the build if there were any warnings, once all of them are reported")
+
+// Build messages may come from several goroutines at once, so they are
+// written one whole line at a time.
+var sayMu sync.Mutex
+
+// Where build messages go, and where warnings and other problems go, apart
+// from them so they stand out and scripts can pick them up
+var sayTo io.Writer = os.Stdout
+var warnTo io.Writer = os.Stderr
+
+// The warnings of the build in progress, guarded by sayMu
+var warnings int
+
+// say prints a build message for the user.
+func say(msg string) {
+	sayMu.Lock()
+	defer sayMu.Unlock()
+	sayLine(sayTo, msg)
+}
+
+// sayProblem prints a message about something that went wrong, but doesn't
+// stop static, like a failed rebuild while serving.
+func sayProblem(msg string) {
+	sayMu.Lock()
+	defer sayMu.Unlock()
+	sayLine(warnTo, msg)
+}
+
+// sayLine writes msg to w as a line, with the time in front with
+// -timestamps. It is called with sayMu held.
+func sayLine(w io.Writer, msg string) {
+	if *timestamps {
+		msg = time.Now().Format("15:04:05.000") + " " + msg
+	}
+	fmt.Fprintln(w, msg)
+}
+
+// sayPage prints a message about the page called name. In verbose mode the
+// page is named, so interleaved messages can be told apart.
+func sayPage(name string, msg string) {
+	if *verbose {
+		msg = "[" + name + "] " + msg
+	}
+	say(msg)
+}
+
+// warnPage reports something that is probably a mistake in the page called
+// name, without stopping the build until checkWarnings with -Werror.
+func warnPage(name string, msg string) {
+	sayMu.Lock()
+	defer sayMu.Unlock()
+	warnings++
+	sayLine(warnTo, "Warning: "+name+": "+msg)
+}
+
+// warningCount returns how many warnings there have been since the last
+// checkWarnings.
+func warningCount() int {
+	sayMu.Lock()
+	defer sayMu.Unlock()
+	return warnings
+}
+
+// checkWarnings fails the build with -Werror if anything was warned about
+// since the last call.
+func checkWarnings() {
+	sayMu.Lock()
+	n := warnings
+	warnings = 0
+	sayMu.Unlock()
+	if n > 0 && *werror {
+		fatal(fmt.Sprintf("%d warnings, which -Werror turns into errors.", n))
+	}
+}
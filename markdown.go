@@ -0,0 +1,112 @@
+package static
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+var markdownTimeout = Flags.Duration("markdown-timeout", 30*time.Second, "how long converting a single page may take")
+
+// markdownCommand returns the stages of the markdown profile a page asks for
+// with its "markdown" key, each a command line the page goes through in
+// turn. Profiles are configured under "markdownProfiles", as a command line
+// string, with stages separated by |, as a list of arguments, or as a list
+// of stages that are lists of arguments. Without a profile the plain
+// markdown command is used.
+func markdownCommand(c config) [][]string {
+	name := configString(c, "markdown", "")
+	if name == "" {
+		return [][]string{{markdownCMD}}
+	}
+	var stages [][]string
+	switch p := configMap(c, "markdownProfiles")[name].(type) {
+	case string:
+		for _, stage := range strings.Split(p, "|") {
+			stages = append(stages, strings.Fields(stage))
+		}
+	case []interface{}:
+		// Arguments are strings, stages are lists
+		if len(p) > 0 {
+			if _, ok := p[0].(string); !ok {
+				for _, stage := range p {
+					stages = append(stages, toStrings(stage))
+				}
+				break
+			}
+		}
+		stages = append(stages, toStrings(p))
+	default:
+		stages = append(stages, toStrings(p))
+	}
+	for _, args := range stages {
+		if len(args) == 0 {
+			fatal("Markdown profile " + name + " is not configured, or has an empty stage.")
+		}
+	}
+	return stages
+}
+
+// markdownCommands returns the commands of all configured profiles, and of
+// the default one, so they can be checked before building.
+func markdownCommands(c config) [][]string {
+	cmds := markdownCommand(c)
+	profiles := configMap(c, "markdownProfiles")
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pc := config{"markdown": name, "markdownProfiles": profiles}
+		cmds = append(cmds, markdownCommand(pc)...)
+	}
+	return cmds
+}
+
+// convertMarkdown runs r through the stages, for the page called name. A
+// stage is killed if it takes longer than -markdown-timeout, and failures
+// of a pipeline of several stages say which stage failed.
+func convertMarkdown(name string, stages [][]string, r io.Reader) []byte {
+	var b []byte
+	for i, args := range stages {
+		doing := name
+		if len(stages) > 1 {
+			doing = fmt.Sprintf("%s at stage %d of %d", name, i+1, len(stages))
+		}
+		b = filter("Converting", doing, args, r, *markdownTimeout)
+		r = bytes.NewReader(b)
+	}
+	return b
+}
+
+// filter pipes r through the command args and returns what it wrote. Any
+// failure stops the build, saying what was being done for which page. A
+// timeout of 0 lets the command take as long as it needs.
+func filter(doing string, name string, args []string, r io.Reader, timeout time.Duration) []byte {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = r
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		fatal(doing + " " + name + ": " + args[0] + " did not finish within " + timeout.String() + ".")
+	}
+	if err != nil {
+		fatal(doing + " " + name + ": " + args[0] + ": " + err.Error())
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,120 @@
+package static
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	fenceRe    = regexp.MustCompile("(?ms)^```.*?^```[^\n]*$")
+	codeSpanRe = regexp.MustCompile("`[^`\n]*`")
+)
+
+// A formula found in a page, taken out before markdown conversion.
+type formula struct {
+	tex     string
+	display bool
+}
+
+// mathDelimiters returns the configured opening and closing delimiters for
+// inline and display math. They default to $...$ and $$...$$.
+func mathDelimiters(c config) (inline []string, display []string) {
+	inline, display = []string{"$", "$"}, []string{"$$", "$$"}
+	d := configMap(c, "mathDelimiters")
+	if s := toStrings(d["inline"]); len(s) == 2 {
+		inline = s
+	}
+	if s := toStrings(d["display"]); len(s) == 2 {
+		display = s
+	}
+	return inline, display
+}
+
+// protectMath replaces the formulas in body by placeholders, so markdown
+// doesn't mistake underscores and asterisks in them for emphasis. Code is
+// left alone.
+func protectMath(body []byte, c config) ([]byte, []formula) {
+	inline, display := mathDelimiters(c)
+	displayRe := regexp.MustCompile(`(?s)` + regexp.QuoteMeta(display[0]) + `(.+?)` + regexp.QuoteMeta(display[1]))
+	// No space just inside the delimiters, so "$5 and $10" is not a formula
+	inlineRe := regexp.MustCompile(regexp.QuoteMeta(inline[0]) + `([^\s` + regexp.QuoteMeta(inline[1]) + `](?:[^\n]*?[^\s])?)` + regexp.QuoteMeta(inline[1]))
+
+	var formulas []formula
+	replace := func(re *regexp.Regexp, isDisplay bool, b []byte) []byte {
+		return re.ReplaceAllFunc(b, func(m []byte) []byte {
+			formulas = append(formulas, formula{string(re.FindSubmatch(m)[1]), isDisplay})
+			return []byte(mathPlaceholder(len(formulas) - 1))
+		})
+	}
+	protect := func(b []byte) []byte {
+		return replace(inlineRe, false, replace(displayRe, true, b))
+	}
+
+	var out bytes.Buffer
+	for _, b := range splitCode(body, fenceRe) {
+		if b.code {
+			out.Write(b.text)
+			continue
+		}
+		for _, s := range splitCode(b.text, codeSpanRe) {
+			if s.code {
+				out.Write(s.text)
+			} else {
+				out.Write(protect(s.text))
+			}
+		}
+	}
+	return out.Bytes(), formulas
+}
+
+// restoreMath puts the formulas back into the converted HTML, rendered by
+// the "mathCommand" if one is configured and otherwise wrapped for KaTeX or
+// MathJax to render in the browser.
+func restoreMath(name string, b []byte, formulas []formula, c config) []byte {
+	cmd := strings.Fields(configString(c, "mathCommand", ""))
+	out := string(b)
+	for i, f := range formulas {
+		var rendered string
+		switch {
+		case len(cmd) > 0 && f.display:
+			rendered = string(filter("Rendering math for", name, append(cmd, "--display-mode"), strings.NewReader(f.tex), *markdownTimeout))
+		case len(cmd) > 0:
+			rendered = string(filter("Rendering math for", name, cmd, strings.NewReader(f.tex), *markdownTimeout))
+		case f.display:
+			rendered = `<div class="math display">\[` + html.EscapeString(f.tex) + `\]</div>`
+		default:
+			rendered = `<span class="math inline">\(` + html.EscapeString(f.tex) + `\)</span>`
+		}
+		ph := mathPlaceholder(i)
+		// A formula on its own line ends up in a paragraph of its own
+		if f.display {
+			out = strings.Replace(out, "<p>"+ph+"</p>", rendered, 1)
+		}
+		out = strings.Replace(out, ph, rendered, 1)
+	}
+	return []byte(out)
+}
+
+// Letters and digits only, which markdown passes through untouched
+func mathPlaceholder(i int) string {
+	return fmt.Sprintf("staticmath%dx", i)
+}
+
+type codeSplit struct {
+	text []byte
+	code bool
+}
+
+// splitCode cuts b into the parts matched by codeRe and the parts between.
+func splitCode(b []byte, codeRe *regexp.Regexp) []codeSplit {
+	var parts []codeSplit
+	last := 0
+	for _, loc := range codeRe.FindAllIndex(b, -1) {
+		parts = append(parts, codeSplit{b[last:loc[0]], false}, codeSplit{b[loc[0]:loc[1]], true})
+		last = loc[1]
+	}
+	return append(parts, codeSplit{b[last:], false})
+}
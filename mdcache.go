@@ -0,0 +1,95 @@
+package static
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var noCache = Flags.Bool("no-cache", false, "convert and render all pages again instead of using the cache")
+var cacheSize = Flags.Int("cache-size", 256, "megabytes of converted markdown, rendered pages and resized images to keep in the cache, dropping what was used least recently")
+
+// cachedMarkdown converts r with the stages like convertMarkdown, unless
+// the cache holds the result for the same input and stages already.
+func cachedMarkdown(name string, stages [][]string, r io.Reader) []byte {
+	if *noCache {
+		return convertMarkdown(name, stages, r)
+	}
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		fatal(err)
+	}
+	h := sha256.New()
+	for i, args := range stages {
+		if i > 0 {
+			// Stages are told apart from the arguments of one command
+			h.Write([]byte("|\x00"))
+		}
+		h.Write([]byte(strings.Join(args, "\x00") + "\x00\x00"))
+	}
+	h.Write(in)
+	cached := filepath.Join(*cacheDir, "markdown", fmt.Sprintf("%x", h.Sum(nil)))
+	if b, err := ioutil.ReadFile(cached); err == nil {
+		// The time of last use decides what is dropped first
+		now := time.Now()
+		os.Chtimes(cached, now, now)
+		return b
+	}
+
+	b := convertMarkdown(name, stages, strings.NewReader(string(in)))
+	writeCacheFile(cached, b)
+	return b
+}
+
+// writeCacheFile writes b to the cache file name in one go, so a build that
+// is interrupted leaves nothing half written behind.
+func writeCacheFile(name string, b []byte) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		fatal(err)
+	}
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		fatal(err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		fatal(err)
+	}
+}
+
+// pruneCache drops the converted markdown, rendered pages and resized
+// images used least recently until the cache is no larger than -cache-size.
+func pruneCache() {
+	type entry struct {
+		path string
+		info os.FileInfo
+	}
+	var entries []entry
+	var total int64
+	for _, dir := range []string{"markdown", "pages", "images"} {
+		// Nothing may be cached yet
+		infos, _ := ioutil.ReadDir(filepath.Join(*cacheDir, dir))
+		for _, info := range infos {
+			entries = append(entries, entry{filepath.Join(*cacheDir, dir, info.Name()), info})
+			total += info.Size()
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].info.ModTime().Before(entries[j].info.ModTime())
+	})
+	limit := int64(*cacheSize) << 20
+	for _, e := range entries {
+		if total <= limit {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			fatal(err)
+		}
+		total -= e.info.Size()
+	}
+}
@@ -0,0 +1,42 @@
+package static
+
+import (
+	"encoding/json"
+	"os"
+)
+
+var metadata = Flags.Bool("metadata", false, "print the values pages set, as JSON, instead of building")
+
+type pageMetadata struct {
+	Name   string                 `json:"name"`
+	Source string                 `json:"source"`
+	URL    string                 `json:"url"`
+	Draft  bool                   `json:"draft,omitempty"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// printMetadata prints the values every page in srcdir sets with its data
+// file and ---set directives, as JSON. Only the directives are read: nothing
+// is converted or rendered, and templates aren't even parsed.
+func printMetadata(srcdir string, dstdir string) {
+	checkSrcDir(srcdir)
+	config := readConfig(srcdir)
+	checkPages(srcdir)
+	pages := readPages(srcdir, dstdir, config, true)
+	list := make([]pageMetadata, 0, len(pages))
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		values := make(map[string]interface{})
+		for _, key := range p.keys {
+			if v, ok := p.config[key]; ok {
+				values[key] = v
+			}
+		}
+		list = append(list, pageMetadata{name, p.src, p.url, p.draft, values})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(list); err != nil {
+		fatal(err)
+	}
+}
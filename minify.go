@@ -0,0 +1,51 @@
+package static
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var minifyCSS = Flags.String("minify-css", "", "command to pipe every static .css file through while copying it, like \"csso\"")
+var minifyJS = Flags.String("minify-js", "", "command to pipe every static .js file through while copying it, like \"terser -c -m\"")
+
+var sourceMapRe = regexp.MustCompile(`(//|/\*)# sourceMappingURL=[^\n]*\n?`)
+
+// minifier returns the command line to minify the static file at rel with,
+// or nil if it is to be copied as it is. Files that are minified already are
+// left alone.
+func minifier(rel string, config config) []string {
+	ext := filepath.Ext(rel)
+	if strings.HasSuffix(strings.TrimSuffix(rel, ext), configString(config, "minSuffix", ".min")) {
+		return nil
+	}
+	switch ext {
+	case ".css":
+		return strings.Fields(*minifyCSS)
+	case ".js":
+		return strings.Fields(*minifyJS)
+	}
+	return nil
+}
+
+// minifyFile writes the static file src to dst through the command args.
+// A source map reference is kept, in case the minifier drops it, unless
+// "stripSourceMaps" is set in the config, which also leaves out the .map
+// files themselves.
+func minifyFile(src string, dst string, args []string, config config) {
+	b, err := readSrcFile(src)
+	if err != nil {
+		fatal(err)
+	}
+	out := filter("Minifying", src, args, bytes.NewReader(b), 0)
+	ref := sourceMapRe.Find(b)
+	out = sourceMapRe.ReplaceAll(out, nil)
+	if ref != nil && !configBool(config, "stripSourceMaps") {
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+		out = append(out, ref...)
+	}
+	writeFile(dst, out)
+}
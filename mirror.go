@@ -0,0 +1,47 @@
+package static
+
+import (
+	"bytes"
+	"html"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var textMirror = Flags.Bool("text-mirror", false, "also write the text of every page below txt/ in the output, listed in llms.txt")
+
+// Where the plain text versions of the pages go, relative to the output
+const mirrorDir = "txt"
+
+// writeTextMirror writes the source text of every page to txt/name.txt, and
+// an llms.txt in the root listing them. Markdown and text pages are written
+// as they were before conversion, HTML pages with the tags stripped. Drafts,
+// generated pages and pages with "noindex" set are left out.
+func writeTextMirror(pages map[string]*page, dstdir string, config config) {
+	var index bytes.Buffer
+	index.WriteString("# " + configString(config, "title", "Pages") + "\n\n")
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		if p.draft || p.src == "" || p.variant || configBool(p.config, "noindex") {
+			continue
+		}
+		text := p.body
+		if configString(p.config, "format", "markdown") == "html" {
+			text = []byte(html.UnescapeString(string(tagRe.ReplaceAll(text, nil))))
+		}
+		rel := path.Join(mirrorDir, name+".txt")
+		writeFile(filepath.Join(dstdir, filepath.FromSlash(rel)), text)
+		index.WriteString("- [" + name + "](" + rel + ")\n")
+	}
+	writeFile(filepath.Join(dstdir, "llms.txt"), index.Bytes())
+}
+
+func writeFile(name string, b []byte) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		fatal(err)
+	}
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+package static
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// Where header values get the nonce of the page, as in
+// "Content-Security-Policy: script-src 'nonce-{nonce}'"
+const noncePlaceholder = "{nonce}"
+
+// newNonce returns a fresh random value for Content-Security-Policy nonces.
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// nonceScope returns how widely a nonce is shared according to the
+// "nonceScope" config key: "build" for one nonce for the whole build, "page"
+// for one for every page, or "" for no nonces at all.
+func nonceScope(c config) string {
+	scope := configString(c, "nonceScope", "")
+	if scope != "" && scope != "build" && scope != "page" {
+		fatal("Unknown nonceScope " + scope + ", it should be build or page.")
+	}
+	return scope
+}
+
+// withNonce fills in the nonce in header values.
+func withNonce(headers map[string]string, nonce string) map[string]string {
+	for name, value := range headers {
+		headers[name] = strings.Replace(value, noncePlaceholder, nonce, -1)
+	}
+	return headers
+}
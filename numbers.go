@@ -0,0 +1,126 @@
+package static
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// How a language writes numbers: what groups thousands and what comes
+// before the decimals
+type numberSeparators struct {
+	thousands string
+	decimal   string
+}
+
+// The languages numberFormat knows, those dateFormatLang knows
+var languageSeparators = map[string]numberSeparators{
+	"de": {".", ","},
+	"en": {",", "."},
+	"es": {".", ","},
+	// A narrow no-break space
+	"fr": {"\u202f", ","},
+	"it": {".", ","},
+	"nl": {".", ","},
+	"pt": {".", ","},
+}
+
+// toNumber takes what templates have for a number, like {{len .pages}}, a
+// number from JSON or one set with ---set.
+func toNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(n), 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// pluralize returns singular or plural, whichever goes with count in lang:
+// {{len .pages}} {{pluralize (len .pages) "post" "posts"}} gives "1 post" or
+// "3 posts". In French and Portuguese 0 takes the singular too. Without a lang
+// the "lang" of the site is used, or else English.
+func pluralize(c config) func(count interface{}, singular string, plural string, lang ...string) (string, error) {
+	return func(count interface{}, singular string, plural string, lang ...string) (string, error) {
+		n, err := toNumber(count)
+		if err != nil {
+			return "", err
+		}
+		n = math.Abs(n)
+		switch langCode(c, lang) {
+		case "fr", "pt":
+			if n < 2 {
+				return singular, nil
+			}
+		default:
+			if n == 1 {
+				return singular, nil
+			}
+		}
+		return plural, nil
+	}
+}
+
+// numberFormat writes n with its thousands grouped the way lang does, and
+// rounded to decimals if given: {{numberFormat 1234567.891 2 "de"}} gives
+// "1.234.567,89". Without decimals, whole numbers get none and others as many
+// as they need. Without a lang the "lang" of the site is used, or else
+// English.
+func numberFormat(c config) func(n interface{}, args ...interface{}) (string, error) {
+	return func(n interface{}, args ...interface{}) (string, error) {
+		f, err := toNumber(n)
+		if err != nil {
+			return "", err
+		}
+		if len(args) > 2 {
+			return "", fmt.Errorf("numberFormat takes a number, decimals and a lang")
+		}
+		decimals := -1
+		if len(args) > 0 {
+			d, err := toNumber(args[0])
+			if err != nil {
+				return "", err
+			}
+			decimals = int(d)
+		}
+		var lang []string
+		if len(args) > 1 {
+			s, ok := args[1].(string)
+			if !ok {
+				return "", fmt.Errorf("%v is not a language", args[1])
+			}
+			lang = []string{s}
+		}
+		code := langCode(c, lang)
+		sep, ok := languageSeparators[code]
+		if !ok {
+			return "", fmt.Errorf("no number format for language %s", code)
+		}
+
+		s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+		whole, frac := s, ""
+		if i := strings.IndexByte(s, '.'); i >= 0 {
+			whole, frac = s[:i], s[i+1:]
+		}
+		var out strings.Builder
+		if f < 0 && strings.Trim(s, "0.") != "" {
+			out.WriteByte('-')
+		}
+		for i, d := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				out.WriteString(sep.thousands)
+			}
+			out.WriteRune(d)
+		}
+		if frac != "" {
+			out.WriteString(sep.decimal + frac)
+		}
+		return out.String(), nil
+	}
+}
@@ -0,0 +1,92 @@
+package static
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var orphans = Flags.Bool("orphans", false, "warn about statics nothing in the output links to, after building")
+
+var (
+	srcsetAttrRe = regexp.MustCompile(`\bsrcset\s*=\s*["']([^"']*)["']`)
+	cssURLRe     = regexp.MustCompile(`url\(\s*["']?([^"')]+?)["']?\s*\)`)
+)
+
+// The output files links to statics are looked for in
+var linkingExts = map[string]bool{".html": true, ".htm": true, ".css": true, ".xml": true}
+
+// warnOrphans warns about the statics of the site in srcdir that none of the
+// pages, stylesheets and feeds built into dstdir link to, with src, href,
+// srcset or url(), except those matching the patterns under "allowOrphans",
+// like ["favicon.ico", "CNAME"].
+func warnOrphans(srcdir string, dstdir string, config config) {
+	linked := make(map[string]bool)
+	err := filepath.Walk(dstdir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !linkingExts[filepath.Ext(file)] {
+			return err
+		}
+		rel, err := filepath.Rel(dstdir, file)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for _, ref := range assetLinks(b) {
+			u, err := url.Parse(ref)
+			if err != nil {
+				continue
+			}
+			if target, ok := localPath(u, filepath.ToSlash(rel), config); ok {
+				linked[path.Clean(target)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	names := config["fingerprints"].(map[string]string)
+	allowed := configList(config, "allowOrphans")
+	statics := listStatics(srcdir, config)
+	outputs := staticOutputPaths(srcdir, statics, config)
+	for _, rel := range statics {
+		rel = filepath.ToSlash(rel)
+		if path.Ext(rel) == ".map" && configBool(config, "stripSourceMaps") {
+			continue
+		}
+		shipped := outputs[rel]
+		if hashed, ok := names[shipped]; ok {
+			shipped = hashed
+		}
+		if !linked[shipped] && !matchesName(allowed, rel) {
+			warnPage(rel, "copied, but nothing links to it")
+		}
+	}
+}
+
+// assetLinks returns the links in b, HTML or CSS, that may be to statics.
+func assetLinks(b []byte) []string {
+	var links []string
+	for _, m := range assetRefRe.FindAllSubmatch(b, -1) {
+		links = append(links, string(m[3]))
+	}
+	for _, m := range srcsetAttrRe.FindAllSubmatch(b, -1) {
+		for _, candidate := range strings.Split(string(m[1]), ",") {
+			if f := strings.Fields(candidate); len(f) > 0 {
+				links = append(links, f[0])
+			}
+		}
+	}
+	for _, m := range cssURLRe.FindAllSubmatch(b, -1) {
+		links = append(links, string(m[1]))
+	}
+	return links
+}
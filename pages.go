@@ -0,0 +1,86 @@
+package static
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pageList returns the configs of all pages for templates to iterate over as
+// {{.pages}}. By default they are sorted by their "weight", lowest first, and
+// then by name. With "sortPagesBy" set to "date" in the config they are
+// sorted by "date" instead, newest first, again falling back to the name.
+func pageList(pages map[string]*page, c config) []config {
+	list := make([]config, 0, len(pages))
+	for _, name := range sortedNames(pages) {
+		if !pages[name].draft {
+			list = append(list, pages[name].config)
+		}
+	}
+
+	byDate := configString(c, "sortPagesBy", "weight") == "date"
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if byDate {
+			da, db := configDate(a, "date"), configDate(b, "date")
+			if !da.Equal(db) {
+				return da.After(db)
+			}
+		} else {
+			wa, wb := configNumber(a, "weight"), configNumber(b, "weight")
+			if wa != wb {
+				return wa < wb
+			}
+		}
+		return configString(a, "name", "") < configString(b, "name", "")
+	})
+	return list
+}
+
+// pageSection returns the top level directory a page is in, or "" for pages
+// in the root.
+func pageSection(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// addAutoIndexes generates a listing page, rendered with the "list"
+// template, for every directory that has pages but no index page of its own.
+// The pages directly in the directory are given to it as {{.sectionPages}}.
+func addAutoIndexes(pages map[string]*page, dstdir string, c config) {
+	dirs := make(map[string]map[string]*page)
+	for name, p := range pages {
+		dir := path.Dir(name)
+		if dir == "." || p.draft {
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]*page)
+		}
+		dirs[dir][name] = p
+	}
+
+	for dir, children := range dirs {
+		name := dir + "/index"
+		if _, ok := pages[name]; ok {
+			continue
+		}
+		pc := cloneConfig(c)
+		pc["name"] = name
+		pc["section"] = pageSection(name)
+		pc["kind"] = kindList
+		pc["format"] = "html"
+		pc["sectionPages"] = pageList(children, c)
+		p := &page{
+			name:     name,
+			url:      caseOutputPath(outputURL(name, configString(c, "trailingSlash", "")), c),
+			config:   pc,
+			template: kindList,
+		}
+		p.dst = filepath.Join(dstdir, filepath.FromSlash(p.url))
+		pages[name] = p
+	}
+}
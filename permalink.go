@@ -0,0 +1,64 @@
+package static
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var permalinkTokenRe = regexp.MustCompile(`:(year|month|day|slug|section)\b`)
+
+// permalinkPattern returns the "permalinkPattern" for the page: either one
+// for all pages, or a map from sections, like "blog", to patterns, with ""
+// for the pages in the root. Pages without one keep the default output path.
+func permalinkPattern(p *page) string {
+	if m := configMap(p.config, "permalinkPattern"); m != nil {
+		s, _ := m[configString(p.config, "section", "")].(string)
+		return s
+	}
+	return configString(p.config, "permalinkPattern", "")
+}
+
+// permalinkURL returns the output path of the page according to pattern, a
+// path like "/:year/:month/:slug/" with tokens for the date of the page, its
+// "slug", which defaults to its file name or bundle directory, and its
+// section. A pattern ending in a slash makes the page the index of that
+// directory; without an extension, .html is added.
+func permalinkURL(p *page, pattern string) string {
+	date := configDate(p.config, "date")
+	slug := configString(p.config, "slug", "")
+	if slug == "" {
+		base := path.Base(p.name)
+		if base == "index" && path.Dir(p.name) != "." {
+			base = path.Base(path.Dir(p.name))
+		}
+		slug = slugify(base)
+	}
+	u := permalinkTokenRe.ReplaceAllStringFunc(pattern, func(token string) string {
+		switch token[1:] {
+		case "slug":
+			return slug
+		case "section":
+			return configString(p.config, "section", "")
+		}
+		if date.IsZero() {
+			fatal("Page " + p.name + " has no date, which permalinkPattern " + pattern + " needs.")
+		}
+		switch token[1:] {
+		case "year":
+			return date.Format("2006")
+		case "month":
+			return date.Format("01")
+		}
+		return date.Format("02")
+	})
+	dir := strings.HasSuffix(u, "/")
+	u = strings.TrimPrefix(path.Clean("/"+u), "/")
+	switch {
+	case u == "" || dir:
+		u = path.Join(u, "index.html")
+	case path.Ext(u) == "":
+		u += ".html"
+	}
+	return u
+}
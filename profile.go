@@ -0,0 +1,43 @@
+package static
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+var cpuProfile = Flags.String("cpuprofile", "", "write a CPU profile of the build to this file")
+var memProfile = Flags.String("memprofile", "", "write a memory profile of the build to this file")
+
+// startProfiling starts the profiles asked for on the command line. The
+// returned function stops them and writes them out.
+func startProfiling() func() {
+	var cpu *os.File
+	if *cpuProfile != "" {
+		var err error
+		cpu, err = os.Create(*cpuProfile)
+		if err != nil {
+			fatal(err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			fatal(err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if *memProfile != "" {
+			f, err := os.Create(*memProfile)
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fatal(err)
+			}
+		}
+	}
+}
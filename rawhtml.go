@@ -0,0 +1,101 @@
+package static
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Opening and closing tags and processing instructions, but not comments,
+// which can't run anything and include the summary divider, and not
+// autolinks like <https://example.org>, which have no tag name
+var rawHTMLRe = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*(?:\s(?:[^>"']|"[^"]*"|'[^']*')*)?/?>|<\?.*?\?>|<![A-Z][^>]*>`)
+
+// What raw HTML is replaced by outside of "markdownUnsafe" sites
+const rawHTMLOmitted = "<!-- raw HTML omitted -->"
+
+// The attributes of tags holding URLs, and the scheme of a URL
+var (
+	urlAttrRe = regexp.MustCompile(`(?i)(\s(?:href|src)\s*=\s*)("[^"]*"|'[^']*'|[^\s"'>]+)`)
+	schemeRe  = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+)
+
+// The schemes links and images in markdown can have outside of
+// "markdownUnsafe" sites, besides none at all
+var safeSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// markdownInput returns the markdown of the page called name as it is given
+// to the converter. Unless "markdownUnsafe" is set, raw HTML outside of code
+// is omitted, so markdown from people who can't be trusted with the site
+// can't add scripts, styles or forms to it. markdownOutput does the rest.
+func markdownInput(name string, b []byte, c config) []byte {
+	if configBool(c, "markdownUnsafe") {
+		return b
+	}
+	omitted := false
+	omit := func(b []byte) []byte {
+		return rawHTMLRe.ReplaceAllFunc(b, func([]byte) []byte {
+			omitted = true
+			return []byte(rawHTMLOmitted)
+		})
+	}
+	var out bytes.Buffer
+	for _, f := range splitCode(b, fenceRe) {
+		if f.code {
+			out.Write(f.text)
+			continue
+		}
+		for _, s := range splitCode(f.text, codeSpanRe) {
+			if s.code {
+				out.Write(s.text)
+			} else {
+				out.Write(omit(s.text))
+			}
+		}
+	}
+	if omitted {
+		warnPage(name, "raw HTML omitted from the markdown, set \"markdownUnsafe\" if its content is trusted")
+	}
+	return out.Bytes()
+}
+
+// markdownOutput returns the HTML converted from the markdown of the page
+// called name. Unless "markdownUnsafe" is set, links and images with other
+// schemes than safeSchemes, like [x](javascript:alert(1)), point to #
+// instead, as they could run scripts too.
+func markdownOutput(name string, b []byte, c config) []byte {
+	if configBool(c, "markdownUnsafe") {
+		return b
+	}
+	replaced := false
+	b = tagRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		return urlAttrRe.ReplaceAllFunc(tag, func(attr []byte) []byte {
+			m := urlAttrRe.FindSubmatch(attr)
+			if safeURL(string(m[2])) {
+				return attr
+			}
+			replaced = true
+			return append(m[1], `"#"`...)
+		})
+	})
+	if replaced {
+		warnPage(name, "links with unsafe schemes replaced in the markdown, set \"markdownUnsafe\" if its content is trusted")
+	}
+	return b
+}
+
+// safeURL reports whether the attribute value v, quoted or not, is a URL
+// with one of safeSchemes or none. Browsers ignore whitespace and control
+// characters in the scheme, so they are left out before looking at it.
+func safeURL(v string) bool {
+	v = html.UnescapeString(strings.Trim(v, `"'`))
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+	m := schemeRe.FindStringSubmatch(v)
+	return m == nil || safeSchemes[strings.ToLower(m[1])]
+}
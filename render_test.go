@@ -0,0 +1,82 @@
+package static
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// How many pages TestRenderConcurrently writes at once, besides the one they
+// all embed
+const concurrentPages = 50
+
+// TestRenderConcurrently writes every page of a site from a goroutine of its
+// own. Each page lists all of them with their excerpts and embeds the same
+// page, so run with -race it shows that writing a page only reads what
+// preparePages made, and that renderPage can be used from any goroutine.
+func TestRenderConcurrently(t *testing.T) {
+	defer func(was bool, to io.Writer) {
+		*noCache = was
+		sayTo = to
+	}(*noCache, sayTo)
+	*noCache = true
+	sayTo = ioutil.Discard
+
+	src, dst := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		configFile:          `{"version": 1, "title": "Site"}`,
+		"default.template":  `{{.title}}|{{.content}}|{{range .pages}}{{.name}}:{{.excerpt}};{{end}}|{{renderPage "shared"}}`,
+		"fragment.template": `<b>{{.content}}</b>`,
+		"shared.page":       "---set format html\n---settemplate fragment\nshared",
+	}
+	for i := 0; i < concurrentPages; i++ {
+		files[fmt.Sprintf("page%02d.page", i)] = fmt.Sprintf("---set format html\n<p>%d</p><!--more--><p>rest</p>", i)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := readConfig(src)
+	prepareConfig(src, config)
+	templates := readTemplates(src, config)
+	pages := preparePages(src, dst, "", config, templates)
+	var wg sync.WaitGroup
+	for _, p := range pages {
+		wg.Add(1)
+		go func(p *page) {
+			defer wg.Done()
+			var err error
+			defer func() {
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+			defer catch(&err)
+			p.write(templates)
+		}(p)
+	}
+	wg.Wait()
+
+	var list strings.Builder
+	for i := 0; i < concurrentPages; i++ {
+		fmt.Fprintf(&list, "page%02d:<p>%d</p>;", i, i)
+	}
+	list.WriteString("shared:;")
+	for i := 0; i < concurrentPages; i++ {
+		name := fmt.Sprintf("page%02d", i)
+		b, err := ioutil.ReadFile(filepath.Join(dst, name+".html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("Site|<p>%d</p><!--more--><p>rest</p>|%s|<b>shared</b>", i, list.String())
+		if string(b) != want {
+			t.Errorf("%s is\n%s\nwant\n%s", name, b, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Keys that don't go into the cache key of a page: they are made from its
+// body and config, or differ on every build, in which case pages whose
+// templates use them aren't cached at all
+var (
+	derivedKeys  = []string{"content", "excerpt", "uses", "pages", "sectionPages"}
+	volatileKeys = []string{"buildTime", "nonce"}
+)
+
+// Keys the build adds to the config of every page, which change with any
+// commit or data file, so they only count for templates that use them
+var siteKeys = []string{"buildVersion", "recentChanges", "data", "env"}
+
+// How the render cache did during this build, guarded by renderCacheMu
+var (
+	renderCacheMu                      sync.Mutex
+	renderCacheHits, renderCacheMisses int
+)
+
+// renderCacheKey returns what the written output of p depends on, hashed:
+// its body, its config but for the siteKeys its template doesn't use, the
+// template it is rendered with, its converter and the flags that change
+// output. It reports false for pages the cache can't tell are unchanged from
+// that: pages whose templates show other pages or files, use values that
+// change with every build, or that get image dimensions or srcsets, and any
+// page when middlewares are set.
+func renderCacheKey(p *page, templates map[string]*template.Template) (string, bool) {
+	// Images are looked at and resized as the content is made
+	if *noCache || len(middlewares) > 0 || configBool(p.config, "imageDimensions") || len(srcsetWidths(p.config)) > 0 {
+		return "", false
+	}
+	t, _ := lookupTemplate(p.templateName(templates), p.config, templates)
+	if t == nil {
+		return "", false
+	}
+	names := templateNames(t)
+	for _, n := range append(append([]string(nil), siteWideNames...), volatileKeys...) {
+		if names[n] {
+			return "", false
+		}
+	}
+
+	c := make(config, len(p.config))
+	for k, v := range p.config {
+		c[k] = v
+	}
+	for _, k := range append(append([]string(nil), derivedKeys...), volatileKeys...) {
+		delete(c, k)
+	}
+	for _, k := range siteKeys {
+		if !names[k] {
+			delete(c, k)
+		}
+	}
+	cb, err := json.Marshal(c)
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	h.Write(p.body)
+	h.Write([]byte{0})
+	h.Write(cb)
+	h.Write([]byte{0})
+	var trees []string
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			trees = append(trees, tt.Name()+"\x00"+tt.Tree.Root.String())
+		}
+	}
+	sort.Strings(trees)
+	h.Write([]byte(strings.Join(trees, "\x00")))
+	fmt.Fprintf(h, "\x00%q %q %q %v %v", p.template, markdownCommand(p.config), *formatCmd, *debugDirectives, *noMarkdown)
+	return fmt.Sprintf("%x", h.Sum(nil)), true
+}
+
+// cachedOutput returns the output written for key by an earlier build.
+func cachedOutput(key string) ([]byte, bool) {
+	cached := filepath.Join(*cacheDir, "pages", key)
+	b, err := ioutil.ReadFile(cached)
+	renderCacheMu.Lock()
+	defer renderCacheMu.Unlock()
+	if err != nil {
+		renderCacheMisses++
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(cached, now, now)
+	renderCacheHits++
+	return b, true
+}
+
+// cacheOutput keeps the output written for key for later builds.
+func cacheOutput(key string, b []byte) {
+	writeCacheFile(filepath.Join(*cacheDir, "pages", key), b)
+}
+
+// sayRenderCacheStats tells how many pages came from the render cache.
+func sayRenderCacheStats() {
+	if renderCacheHits+renderCacheMisses == 0 {
+		return
+	}
+	say(fmt.Sprintf("Render cache: %d pages reused, %d rendered.", renderCacheHits, renderCacheMisses))
+}
@@ -0,0 +1,40 @@
+package static
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// writeRobots writes robots.txt if "robots" is set in the config, to true or
+// to an object listing the paths crawlers may "allow" and "disallow". Builds
+// for another environment than "prod" disallow everything, so previews don't
+// end up in search engines. A sitemap.xml in the output is pointed to.
+func writeRobots(dstdir string, c config) {
+	if c["robots"] == nil || c["robots"] == false {
+		return
+	}
+	var out bytes.Buffer
+	out.WriteString("User-agent: *\n")
+	if *env != "prod" {
+		out.WriteString("Disallow: /\n")
+	} else {
+		rules := config(configMap(c, "robots"))
+		for _, p := range configList(rules, "allow") {
+			out.WriteString("Allow: " + p + "\n")
+		}
+		disallow := configList(rules, "disallow")
+		for _, p := range disallow {
+			out.WriteString("Disallow: " + p + "\n")
+		}
+		if len(disallow) == 0 {
+			// An empty Disallow allows everything
+			out.WriteString("Disallow:\n")
+		}
+		if _, err := os.Stat(filepath.Join(dstdir, "sitemap.xml")); err == nil {
+			out.WriteString("\nSitemap: " + absURL(c, "sitemap.xml") + "\n")
+		}
+	}
+	say("    robots.txt")
+	writeFile(filepath.Join(dstdir, "robots.txt"), out.Bytes())
+}
@@ -0,0 +1,141 @@
+package static
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const schemaFile = "config.schema.json"
+
+// A schema is the subset of JSON Schema we support: type, enum, pattern,
+// properties, required, additionalProperties (as a boolean) and items.
+type schema struct {
+	Type                 interface{}        `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+}
+
+// validateConfig checks c against the schema file in dir, if there is one,
+// and stops the build listing every problem found.
+func validateConfig(dir string, c config) {
+	b, err := readSrcFile(filepath.Join(dir, schemaFile))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+	var s schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		fatal(schemaFile + ": " + err.Error())
+	}
+
+	problems := s.validate("config", map[string]interface{}(c))
+	if len(problems) > 0 {
+		fatal("Config does not match " + schemaFile + ":\n    " + strings.Join(problems, "\n    "))
+	}
+}
+
+func (s *schema) validate(path string, v interface{}) []string {
+	if s.Type != nil && !s.hasType(v) {
+		return []string{fmt.Sprintf("%s: expected %v, got %s", path, s.Type, jsonType(v))}
+	}
+
+	var problems []string
+	if s.Enum != nil {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", path, v, s.Enum))
+		}
+	}
+	if str, ok := v.(string); ok && s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			fatal(schemaFile + ": " + err.Error())
+		}
+		if !re.MatchString(str) {
+			problems = append(problems, fmt.Sprintf("%s: %q does not match %s", path, str, s.Pattern))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range s.Required {
+			if _, ok := v[k]; !ok {
+				problems = append(problems, path+"."+k+": missing")
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				problems = append(problems, p.validate(path+"."+k, v[k])...)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				problems = append(problems, path+"."+k+": unknown key")
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	}
+	return problems
+}
+
+// The type keyword may be a single type name or a list of them.
+func (s *schema) hasType(v interface{}) bool {
+	var types []interface{}
+	switch t := s.Type.(type) {
+	case string:
+		types = []interface{}{t}
+	case []interface{}:
+		types = t
+	}
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,162 @@
+package static
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var serve = Flags.Bool("serve", false, "serve the output directory over HTTP after building")
+var port = Flags.Int("port", 8080, "port for the development server")
+var portAuto = Flags.Bool("port-auto", false, "serve on any free port if the default one is taken")
+var openBrowser = Flags.Bool("open", false, "open the served site in a browser")
+
+// Extensions we want to get right regardless of the system mime tables.
+var contentTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".json":  "application/json",
+	".xml":   "application/xml",
+	".svg":   "image/svg+xml",
+	".txt":   "text/plain; charset=utf-8",
+	".wasm":  "application/wasm",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+func init() {
+	for ext, typ := range contentTypes {
+		mime.AddExtensionType(ext, typ)
+	}
+}
+
+type fileServer struct {
+	root string
+}
+
+func (s fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+	fi, err := os.Stat(name)
+	if err == nil && fi.IsDir() {
+		name = filepath.Join(name, "index.html")
+		fi, err = os.Stat(name)
+	}
+	// Pages linked to without .html, as with "trailingSlash": "never"
+	if os.IsNotExist(err) && filepath.Ext(name) != ".html" {
+		if hfi, herr := os.Stat(name + ".html"); herr == nil && !hfi.IsDir() {
+			name, fi, err = name+".html", hfi, nil
+		}
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if typ := mime.TypeByExtension(filepath.Ext(name)); typ != "" {
+		w.Header().Set("Content-Type", typ)
+	}
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	// Prefer a precompressed sibling when the client can handle it
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if gzfi, err := os.Stat(name + ".gz"); err == nil && !gzfi.IsDir() {
+			name, fi = name+".gz", gzfi
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+	// ServeContent takes care of If-None-Match, If-Modified-Since and Range
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+}
+
+func serveDir(dir string) {
+	addr := fmt.Sprintf("localhost:%d", *port)
+	l, err := net.Listen("tcp", addr)
+	if err != nil && *portAuto && !portSet() {
+		say("Port " + fmt.Sprint(*port) + " is taken, picking a free one.")
+		l, err = net.Listen("tcp", "localhost:0")
+	}
+	if err != nil {
+		fatal(err)
+	}
+	url := fmt.Sprintf("http://localhost:%d/", l.Addr().(*net.TCPAddr).Port)
+	say("Serving " + dir + " on " + url)
+	if *openBrowser {
+		openURL(url)
+	}
+
+	// Ctrl-C stops the server cleanly, letting requests in flight finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Handler: fileServer{root: dir}}
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		say("Stopping the server.")
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+		close(done)
+	}()
+	if err := srv.Serve(l); err != http.ErrServerClosed {
+		fatal(err)
+	}
+	<-done
+}
+
+// portSet tells whether -port was given explicitly, in which case that is
+// the port to serve on, taken or not.
+func portSet() bool {
+	set := false
+	Flags.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			set = true
+		}
+	})
+	return set
+}
+
+// openURL tries to show url in the default browser. Not managing to is
+// no reason to stop serving.
+func openURL(url string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		say("Could not open a browser: " + err.Error())
+		return
+	}
+	// Don't leave a zombie behind
+	go cmd.Wait()
+}
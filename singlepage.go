@@ -0,0 +1,100 @@
+package static
+
+import (
+	"bytes"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"text/template"
+)
+
+var singlePage = Flags.String("singlepage", "", "also write the content of all pages as one HTML file with this name in the output")
+
+var idRe = regexp.MustCompile(`\bid="([^"]*)"`)
+
+// writeSinglePage writes the content of every page of the site, in the
+// order of {{.pages}}, to the file out in dstdir, for reading offline or
+// printing. Each page becomes a section, its ids prefixed with its slug so
+// they don't clash, and links between pages become links within the file.
+// The result is wrapped in the "singlePageTemplate", singlepage.template by
+// default, which gets the sections as {{.sections}}, each with a name,
+// title, anchor and content, all of them together as {{.content}}, and
+// {{.printMode}} set.
+// Drafts, generated pages and non-HTML pages are left out.
+func writeSinglePage(pages map[string]*page, dstdir string, out string, c config, templates map[string]*template.Template) {
+	anchors := make(map[*page]string)
+	var included []*page
+	for _, pc := range pageList(pages, c) {
+		p := pages[configString(pc, "name", "")]
+		if p.src == "" || p.variant {
+			continue
+		}
+		p.fillContent()
+		if p.kind != kindHTML {
+			continue
+		}
+		anchors[p] = slugify(p.name)
+		included = append(included, p)
+	}
+
+	var sections []config
+	var all bytes.Buffer
+	for _, p := range included {
+		content := singlePageContent(p, pages, anchors, out)
+		sections = append(sections, config{
+			"name":    p.name,
+			"title":   configString(p.config, "title", p.name),
+			"anchor":  anchors[p],
+			"content": content,
+		})
+		all.WriteString(`<section id="` + anchors[p] + `">` + "\n" + content + "</section>\n")
+	}
+
+	sc := cloneConfig(c)
+	sc["sections"] = sections
+	sc["content"] = all.String()
+	sc["printMode"] = true
+	t, _ := findTemplate(configString(c, "singlePageTemplate", "singlepage"), c, templates)
+	var b bytes.Buffer
+	if err := t.Execute(&b, sc); err != nil {
+		fatal("Rendering " + out + ": " + err.Error())
+	}
+	writeFile(filepath.Join(dstdir, filepath.FromSlash(out)), b.Bytes())
+}
+
+// singlePageContent returns the content of p with its ids namespaced by its
+// anchor, links to included pages pointing to their section, and other
+// links within the site made relative to out.
+func singlePageContent(p *page, pages map[string]*page, anchors map[*page]string, out string) string {
+	b := []byte(configString(p.config, "content", ""))
+	b = idRe.ReplaceAll(b, []byte(`id="`+anchors[p]+`-${1}"`))
+	b = assetRefRe.ReplaceAllFunc(b, func(attr []byte) []byte {
+		m := assetRefRe.FindSubmatch(attr)
+		u, err := url.Parse(string(m[3]))
+		if err != nil {
+			return attr
+		}
+		link := func(s string) []byte {
+			return []byte(string(m[1]) + string(m[2]) + s + string(m[4]))
+		}
+		if u.Scheme == "" && u.Host == "" && u.Path == "" {
+			if u.Fragment == "" {
+				return attr
+			}
+			return link("#" + anchors[p] + "-" + u.Fragment)
+		}
+		rel, ok := localPath(u, p.url, p.config)
+		if !ok {
+			return attr
+		}
+		if target, ok := findPage(pages, rel); ok && anchors[target] != "" {
+			if u.Fragment != "" {
+				return link("#" + anchors[target] + "-" + u.Fragment)
+			}
+			return link("#" + anchors[target])
+		}
+		u.Path = relativeURL(out, rel, "")
+		return link(u.String())
+	})
+	return string(b)
+}
@@ -0,0 +1,68 @@
+package static
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var sitesFile = Flags.String("sites", "", "build all sites listed in this file, sharing their templates")
+
+// A sitesConfig describes several sites built in one go. Paths are relative
+// to the file it is read from.
+type sitesConfig struct {
+	// Directory with the templates all sites share
+	Templates string `json:"templates"`
+	// Config every site starts from
+	Config config `json:"config"`
+	Sites  []struct {
+		Src string `json:"src"`
+		Dst string `json:"dst"`
+		// Overrides for this site, applied after its own config.json
+		Config config `json:"config"`
+	} `json:"sites"`
+}
+
+// buildSites builds each site in the sites file in turn. The templates are
+// parsed only once.
+func buildSites(file string) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		fatal(err)
+	}
+	var sc sitesConfig
+	if err := json.Unmarshal(b, &sc); err != nil {
+		fatal(file + ": " + err.Error())
+	}
+	dir := filepath.Dir(file)
+
+	templates := readTemplates(filepath.Join(dir, sc.Templates), sc.Config)
+	for _, site := range sc.Sites {
+		src, dst := filepath.Join(dir, site.Src), filepath.Join(dir, site.Dst)
+		say("Building " + src + ":")
+		checkSrcDir(src)
+		c := make(config)
+		for k, v := range sc.Config {
+			c[k] = v
+		}
+		if _, err := os.Stat(filepath.Join(src, configFile)); err == nil {
+			for k, v := range readConfig(src) {
+				c[k] = v
+			}
+		}
+		for k, v := range site.Config {
+			c[k] = v
+		}
+		checkRequirements(c)
+		prepareConfig(src, c)
+		checkDefaultTemplate(c, templates)
+
+		// The shared templates have to see this site's config
+		funcs := templateFuncs(c)
+		for _, t := range templates {
+			t.Funcs(funcs)
+		}
+		build(src, dst, c, templates)
+	}
+}
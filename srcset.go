@@ -0,0 +1,179 @@
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var srcsetRe = regexp.MustCompile(`\bsrcset\s*=`)
+
+// srcsetWidths returns the widths configured under "srcset", smallest first.
+func srcsetWidths(c config) []int {
+	list, _ := configMap(c, "srcset")["widths"].([]interface{})
+	var widths []int
+	for _, v := range list {
+		if w, ok := v.(float64); ok && w > 0 {
+			widths = append(widths, int(w))
+		}
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// addSrcsets gives the local JPEG and PNG images in the HTML of the page at
+// the output path from, below the output directory root, a srcset of copies
+// resized to the "srcset" widths smaller than the image itself, and the
+// "sizes" they are shown at, "100vw" unless configured. The copies are
+// written next to the image, with the width in their name: photo-480w.jpg.
+// Images with a srcset of their own, SVGs, GIFs, which may be animated, and
+// images on other sites are left alone.
+func addSrcsets(b []byte, root string, from string, c config) []byte {
+	widths := srcsetWidths(c)
+	if len(widths) == 0 {
+		return b
+	}
+	sc := configMap(c, "srcset")
+	sizes, _ := sc["sizes"].(string)
+	if sizes == "" {
+		sizes = "100vw"
+	}
+	quality := jpeg.DefaultQuality
+	if q, ok := sc["quality"].(float64); ok {
+		quality = int(q)
+	}
+	names, _ := c["fingerprints"].(map[string]string)
+	return imgRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		if srcsetRe.Match(tag) {
+			return tag
+		}
+		m := imgSrcRe.FindSubmatch(tag)
+		if m == nil {
+			return tag
+		}
+		u, err := url.Parse(string(m[1]))
+		if err != nil {
+			return tag
+		}
+		rel, ok := localPath(u, from, c)
+		if !ok {
+			return tag
+		}
+		if hashed, ok := names[rel]; ok {
+			rel = hashed
+		}
+		ext := strings.ToLower(path.Ext(rel))
+		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+			return tag
+		}
+		src, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return tag
+		}
+		ic, _, err := image.DecodeConfig(bytes.NewReader(src))
+		if err != nil {
+			return tag
+		}
+		dir := path.Dir(u.Path)
+		var set []string
+		for _, w := range widths {
+			if w >= ic.Width {
+				break
+			}
+			name := strings.TrimSuffix(rel, path.Ext(rel)) + "-" + strconv.Itoa(w) + "w" + path.Ext(rel)
+			writeFile(filepath.Join(root, filepath.FromSlash(name)), resizedImage(rel, src, w, ext, quality))
+			set = append(set, path.Join(dir, path.Base(name))+" "+strconv.Itoa(w)+"w")
+		}
+		if len(set) == 0 {
+			return tag
+		}
+		// The image itself is the largest
+		set = append(set, path.Join(dir, path.Base(rel))+" "+strconv.Itoa(ic.Width)+"w")
+		return addAttr(tag, `srcset="`+strings.Join(set, ", ")+`" sizes="`+sizes+`"`)
+	})
+}
+
+// resizedImage returns the image src, the static at rel, scaled down to width
+// and encoded like the original. Resized images are cached by the contents of
+// the original, unless -no-cache is given.
+func resizedImage(rel string, src []byte, width int, ext string, quality int) []byte {
+	cached := filepath.Join(*cacheDir, "images", fmt.Sprintf("%x-%dw-q%d%s", sha256.Sum256(src), width, quality, ext))
+	if !*noCache {
+		if b, err := ioutil.ReadFile(cached); err == nil {
+			now := time.Now()
+			os.Chtimes(cached, now, now)
+			return b
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		fatal("Resizing " + rel + ": " + err.Error())
+	}
+	var out bytes.Buffer
+	if ext == ".png" {
+		err = png.Encode(&out, scaleDown(img, width))
+	} else {
+		err = jpeg.Encode(&out, scaleDown(img, width), &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		fatal("Resizing " + rel + ": " + err.Error())
+	}
+	if !*noCache {
+		writeCacheFile(cached, out.Bytes())
+	}
+	return out.Bytes()
+}
+
+// scaleDown shrinks img to width, keeping its aspect ratio, by averaging the
+// pixels each new pixel covers.
+func scaleDown(img image.Image, width int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*b.Dy()/height, (y+1)*b.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*b.Dx()/width, (x+1)*b.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += int(row[sx*4+i])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for j := 0; j < 4; j++ {
+				dst.Pix[i+j] = uint8(sum[j] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,174 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var sinceLastBuild = Flags.Bool("since-mtime", false, "only rebuild the pages and statics changed since the last build, as recorded in the output")
+var force = Flags.Bool("force", false, "with -since-mtime, rebuild everything anyway")
+
+// Where a build records what it was built from, relative to the output
+const stateFile = ".static-state.json"
+
+// The sources a build was made from, with the hashes of their contents,
+// and which files each page depends on, as returned by pageDeps
+type buildState struct {
+	Env   string              `json:"env"`
+	Files map[string]string   `json:"files"`
+	Deps  map[string][]string `json:"deps"`
+	// The files the pages were written to, relative to the output, by name
+	Outputs map[string]string `json:"outputs"`
+}
+
+// changedSinceState compares srcdir to the state recorded in dstdir by the
+// last build. It returns the paths of the changed pages and statics and of
+// the pages depending on changed templates, includes and data, or nil if
+// everything should be rebuilt: when there is no state, -force is given,
+// files were removed or templates added, or the config changed.
+func changedSinceState(srcdir string, dstdir string) map[string]bool {
+	if *force {
+		return nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dstdir, stateFile))
+	if err != nil {
+		say("No state of a previous build, doing a full build.")
+		return nil
+	}
+	var old buildState
+	if err := json.Unmarshal(b, &old); err != nil {
+		say("Could not read the state of the previous build, doing a full build: " + err.Error())
+		return nil
+	}
+	current := readState(srcdir, old.Deps)
+	if old.Env != current.Env {
+		say("Building for another environment, doing a full build.")
+		return nil
+	}
+	for rel := range old.Files {
+		if _, ok := current.Files[rel]; !ok {
+			say("Removed " + rel + ", doing a full build.")
+			return nil
+		}
+	}
+
+	changed := make(map[string]bool)
+	var files []string
+	for rel, hash := range current.Files {
+		prev, existed := old.Files[rel]
+		if prev == hash {
+			continue
+		}
+		switch {
+		case rel == configFile, rel == schemaFile, !existed && strings.HasSuffix(rel, ".template"):
+			// A new template may be picked over the one pages used
+			say("Changed " + rel + ", doing a full build.")
+			return nil
+		case strings.HasSuffix(rel, *pageExt+".json"):
+			changed[filepath.Join(srcdir, strings.TrimSuffix(rel, ".json"))] = true
+		case !strings.HasSuffix(rel, ".template") && !strings.HasPrefix(rel, dataDir+"/"):
+			changed[filepath.Join(srcdir, filepath.FromSlash(rel))] = true
+		}
+		files = append(files, rel)
+	}
+	if len(files) == 0 {
+		return changed
+	}
+	// Pages the last build didn't record might depend on anything
+	for rel := range current.Files {
+		if !strings.HasSuffix(rel, *pageExt) {
+			continue
+		}
+		deps, known := old.Deps[rel]
+		for _, file := range files {
+			if !known || dependsOn(deps, file) {
+				changed[filepath.Join(srcdir, filepath.FromSlash(rel))] = true
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// readState hashes every file below srcdir but those static writes, and the
+// files outside of it the pages in deps include.
+func readState(srcdir string, deps map[string][]string) buildState {
+	state := buildState{Env: *env, Files: make(map[string]string)}
+	err := walkSrc(srcdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if isOutputDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(srcdir, path)
+		if err != nil {
+			return err
+		}
+		b, err := readSrcFile(path)
+		if err != nil {
+			return err
+		}
+		state.Files[filepath.ToSlash(rel)] = fmt.Sprintf("%x", sha256.Sum256(b))
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+	for _, files := range deps {
+		for _, rel := range files {
+			if !strings.HasPrefix(rel, "../") {
+				continue
+			}
+			// Gone, it counts as removed
+			if b, err := readSrcFile(filepath.Join(srcdir, filepath.FromSlash(rel))); err == nil {
+				state.Files[rel] = fmt.Sprintf("%x", sha256.Sum256(b))
+			}
+		}
+	}
+	return state
+}
+
+// writeState records what dstdir was just built from, what its pages
+// depend on and where they were written. Files the last build wrote pages to
+// that no page is written to any more, because a page moved with ---set
+// outputPath or the like, are removed.
+func writeState(srcdir string, dstdir string, deps map[string][]string, pages map[string]*page) {
+	state := readState(srcdir, deps)
+	state.Deps = deps
+	state.Outputs = make(map[string]string)
+	written := make(map[string]bool)
+	for name, p := range pages {
+		if rel := relSlash(dstdir, p.dst); !strings.HasPrefix(rel, "../") {
+			state.Outputs[name] = rel
+			written[rel] = true
+		}
+	}
+
+	var old buildState
+	if b, err := ioutil.ReadFile(filepath.Join(dstdir, stateFile)); err == nil && json.Unmarshal(b, &old) == nil {
+		for _, rel := range old.Outputs {
+			if written[rel] {
+				continue
+			}
+			say("Removing " + rel + ", which no page is written to any more.")
+			if err := os.Remove(filepath.Join(dstdir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+				fatal(err)
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	writeFile(filepath.Join(dstdir, stateFile), b)
+}
@@ -1,20 +1,25 @@
-package main
+package static
 
 import (
 	"bufio"
+	"bytes"
+	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
-	"bytes"
-	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 )
 
 // Values may be string or map[string]interface{} or []interface{}
@@ -25,170 +30,459 @@ const (
 	markdownCMD     = "markdown"
 	defaultTemplate = "default"
 	configFile      = "config.json"
+	markerFile      = ".static-site"
+)
+
+// Exit codes for the mistakes new users make most
+const (
+	exitNoSrc    = 3
+	exitNoConfig = 4
+	exitNoPages  = 5
+	exitNoMarker = 6
 )
 
-var srcDir = flag.String("src", "src", "directory where to find the source files")
-var dstDir = flag.String("dst", "dst", "directory to write the output to")
+// The built-in theme, for sites that only bring content
+//
+//go:embed theme/*.template
+var theme embed.FS
+
+// Flags are the settings of static, which Run sets from the command line.
+// Build uses them as they are, so programs building a site themselves can
+// Set them first.
+var Flags = flag.NewFlagSet("static", flag.ExitOnError)
+
+var srcDir = Flags.String("src", "src", "directory where to find the source files")
+var dstDir = Flags.String("dst", "dst", "directory to write the output to")
+var env = Flags.String("env", "dev", "environment to build for, \"prod\" for production")
+var preview = Flags.Bool("preview", false, "build drafts into a separate preview directory")
+var previewDst = Flags.String("preview-dst", "", "directory to write drafts to with -preview (default: the dst directory with -preview appended)")
+var debugDirectives = Flags.Bool("debug-directives", false, "keep directive lines in the output as HTML comments")
+var defaultTemplateFlag = Flags.String("default-template", "", "template for pages without ---settemplate (default: the \"defaultTemplate\" config key, or \"default\")")
+var strict = Flags.Bool("strict", false, "fail when a template uses a key that isn't set")
+var formatCmd = Flags.String("format-cmd", "", "command to pipe the HTML of every page through before writing it, like \"tidy -q\"")
+var noMarker = Flags.Bool("no-marker", false, "build even if the src directory has no "+markerFile+" file or \"version\" config key")
+var baseURL = Flags.String("baseurl", "", "base URL to build for, overriding the \"baseurl\" config key")
+var maintenance = Flags.Bool("maintenance", false, "only build the maintenance page, as the index of the site, and the static files")
+var pageExt = Flags.String("page-ext", ".page", "extension of the page files, like \".md\"")
+var noMarkdown = Flags.Bool("no-markdown", false, "take all pages and ---setmarkdownblocks to be HTML already, without needing a markdown command")
+var verbose = Flags.Bool("v", false, "print more details about what is being done")
+
+// exit stops the build with a message meant for the user rather than a
+// developer, which the static command exits with code.
+func exit(code int, msg string) {
+	panic(&Error{Code: code, Msg: msg})
+}
+
+func checkSrcDir(dir string) {
+	info, err := statSrc(dir)
+	if os.IsNotExist(err) {
+		exit(exitNoSrc, "Source directory "+dir+"/ does not exist. Create it or point -src at your site.")
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if !info.IsDir() {
+		exit(exitNoSrc, "Source "+dir+" is not a directory.")
+	}
+}
+
+// checkMarker refuses to build a src directory that hasn't been marked as a
+// site, by a markerFile or a "version" config key. Building the wrong
+// directory would clear whatever output directory happens to be around.
+func checkMarker(dir string, config config) {
+	if *noMarker || config["version"] != nil {
+		return
+	}
+	if _, err := statSrc(filepath.Join(dir, markerFile)); err == nil {
+		return
+	}
+	exit(exitNoMarker, dir+"/ doesn't look like a site: add an empty "+markerFile+" file or a \"version\" key to its "+configFile+", or run with -no-marker.")
+}
+
+// checkPages makes sure there is something to build before we go and remove
+// the previous output.
+func checkPages(dir string) {
+	found := errors.New("found")
+	err := walkSrc(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, *pageExt) {
+			return found
+		}
+		return nil
+	})
+	if err == nil {
+		exit(exitNoPages, "No "+*pageExt+" files to process in "+dir+"/.")
+	}
+	if err != found {
+		fatal(err)
+	}
+}
 
 func readConfig(dir string) config {
-	fmt.Println("Reading config.")
-	f, err := os.Open(filepath.Join(dir, configFile))
+	say("Reading config.")
+	f, err := openSrc(filepath.Join(dir, configFile))
+	if os.IsNotExist(err) {
+		exit(exitNoConfig, "No "+configFile+" found in "+dir+"/. Create one, it may be as simple as {}.")
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	defer f.Close()
 
 	b, err := ioutil.ReadAll(f)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	c := make(config)
 	err = json.Unmarshal(b, &c)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	validateConfig(dir, c)
 	return c
 }
 
-func checkRequirements() {
-	_, err := exec.LookPath(markdownCMD)
-	if err != nil {
-		log.Fatal(err)
+func checkRequirements(config config) {
+	var cmds [][]string
+	if !*noMarkdown {
+		cmds = markdownCommands(config)
+	}
+	for _, cmd := range []string{*formatCmd, *minifyCSS, *minifyJS} {
+		if cmd != "" {
+			cmds = append(cmds, strings.Fields(cmd))
+		}
+	}
+	if enc := outputEncoding(config); enc != "" {
+		lookupEncoding(enc)
+	}
+	for _, cmd := range cmds {
+		_, err := exec.LookPath(cmd[0])
+		if err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// templateDelims returns the delimiters of the site's templates, from the
+// "templateDelims" config key, like ["[[", "]]"], or "" for the usual {{ }}.
+func templateDelims(config config) (string, string) {
+	delims := configList(config, "templateDelims")
+	if delims == nil {
+		return "", ""
+	}
+	if len(delims) != 2 || delims[0] == "" || delims[1] == "" {
+		fatal("templateDelims should be a left and a right delimiter, like [\"[[\", \"]]\"].")
 	}
+	return delims[0], delims[1]
 }
 
-func readTemplates(dir string) map[string]*template.Template {
-	fmt.Println("Reading templates:")
-	paths, err := filepath.Glob(filepath.Join(dir, "*.template"))
+func readTemplates(dir string, config config) map[string]*template.Template {
+	say("Reading templates:")
+	paths, err := globSrc(filepath.Join(dir, "*.template"))
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
+	left, right := templateDelims(config)
 	templates := make(map[string]*template.Template)
 	for _, path := range paths {
 		name := strings.TrimSuffix(filepath.Base(path), ".template")
-		fmt.Println("    " + name)
-		templates[name], err = template.ParseFiles(path)
+		say("    " + name)
+		b, err := readSrcFile(path)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+		templates[name], err = template.New(filepath.Base(path)).Delims(left, right).Funcs(templateFuncs(config)).Parse(string(b))
+		if err != nil {
+			fatal(err)
 		}
 	}
-	return templates
-}
 
-func clearDir(dir string) {
-	fmt.Println("Removing any previous output.")
-	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	// Only the site's own templates; the built-in ones check what they use
+	if *strict {
+		for _, t := range templates {
+			t.Option("missingkey=error")
+		}
+	}
+
+	// Anything the site doesn't define comes from the built-in theme
+	paths, err = fs.Glob(theme, "theme/*.template")
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	for _, path := range paths {
-		err := os.RemoveAll(path)
+		name := strings.TrimSuffix(filepath.Base(path), ".template")
+		if _, ok := templates[name]; ok {
+			continue
+		}
+		say("    " + name + " (built in)")
+		templates[name], err = template.New(filepath.Base(path)).Funcs(templateFuncs(config)).ParseFS(theme, path)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
+		}
+	}
+	return templates
+}
+
+func clearDir(dir string, keep []string) {
+	say("Removing any previous output.")
+	clearBelow(dir, "", keep)
+}
+
+// clearBelow removes what is in the directory rel below dir, except for the
+// paths matching one of the keep patterns. Directories holding kept paths
+// are cleared instead of removed.
+func clearBelow(dir string, rel string, keep []string) {
+	paths, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(rel), "*"))
+	if err != nil {
+		fatal(err)
+	}
+	for _, p := range paths {
+		name := path.Join(rel, filepath.Base(p))
+		if keepMatch(keep, name, false) {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() && keepMatch(keep, name, true) {
+			clearBelow(dir, name, keep)
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// keepMatch reports whether name matches one of the patterns or, with below
+// set, whether there may be a matching path inside the directory name.
+func keepMatch(patterns []string, name string, below bool) bool {
+	parts := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		pp := strings.Split(strings.Trim(pattern, "/"), "/")
+		if below && len(pp) <= len(parts) || !below && len(pp) != len(parts) {
+			continue
+		}
+		matched := true
+		for i, part := range parts {
+			if ok, _ := path.Match(pp[i], part); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
 		}
 	}
+	return false
 }
 
-// Also makes sure everything is a string in there
+// Lists and maps holding only strings become []string and map[string]string.
+// Numbers, booleans and mixed values keep the types JSON gave them.
 func cloneConfig(c config) config {
 	newc := make(config)
 	for k, v := range c {
-		switch v := v.(type) {
-		case string:
-			newc[k] = v
-		case map[string]interface{}:
-			m := make(map[string]string)
-			for k2, v2 := range v {
-				m[k2] = v2.(string)
+		newc[k] = cloneValue(v)
+	}
+	return newc
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]string)
+		for k, v2 := range v {
+			s, ok := v2.(string)
+			if !ok {
+				return cloneMap(v)
 			}
-			newc[k] = m
-		case []interface{}:
-			s := make([]string, 0, len(v))
-			for _, v2 := range v {
-				s = append(s, v2.(string))
+			m[k] = s
+		}
+		return m
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, v2 := range v {
+			str, ok := v2.(string)
+			if !ok {
+				return cloneSlice(v)
 			}
-			newc[k] = s
+			s = append(s, str)
 		}
+		return s
+	case map[string]string:
+		m := make(map[string]string)
+		for k, v2 := range v {
+			m[k] = v2
+		}
+		return m
+	case []string:
+		return append([]string(nil), v...)
 	}
-	return newc
+	return v
 }
 
-func convertMarkdown(r io.Reader) []byte {
-	cmd := exec.Command("markdown")
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
+func cloneMap(v map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for k, v2 := range v {
+		m[k] = cloneValue(v2)
 	}
-	// TODO handle errors
-	io.Copy(stdin, r)
-	stdin.Close()
-	if err := cmd.Wait(); err != nil {
-		log.Fatal(err)
+	return m
+}
+
+func cloneSlice(v []interface{}) []interface{} {
+	s := make([]interface{}, 0, len(v))
+	for _, v2 := range v {
+		s = append(s, cloneValue(v2))
 	}
-	return b.Bytes()
+	return s
 }
 
-func processPage(name string, src string, dst string, config config, templates map[string]*template.Template) {
+// Kinds of content a page can turn out to have
+const (
+	kindHTML = "html"
+	kindText = "text"
+)
+
+// A page is a source page with its directives applied. Its output is only
+// rendered when it is needed, so that pages can embed each other.
+//
+// Every page has a config of its own, cloned from the site config. Once
+// preparePages is done, nothing changes it any more: {{.pages}} hands the
+// configs of all pages to every template. Only the output of a page is
+// written while pages are rendered, under mu.
+type page struct {
+	name      string
+	src       string
+	dst       string
+	url       string
+	draft     bool
+	kind      string
+	config    config
+	template  string
+	keys      []string
+	includes  []string
+	body      []byte
+	output    []byte
+	converted bool
+	// Guards output, as renderPage renders pages from the goroutines of
+	// others
+	mu sync.Mutex
+	// Another version of a page, like its AMP one, which is written but not
+	// listed, linted or exported as a page of its own
+	variant bool
+}
+
+// readPage reads the page at src and applies its directives to a clone of
+// config. The body is not converted yet. With directivesOnly nothing but the
+// directives is worked out, for tools that only want what pages set:
+// ---setmarkdownblock values are left unconverted, and ---source and ---code
+// aren't fetched or read.
+func readPage(name string, src string, config config, directivesOnly bool) *page {
 	config = cloneConfig(config)
-	setRe := regexp.MustCompile("^---set ([a-z]+) (.+)\n?$")
-	setBlockRe := regexp.MustCompile("^---setblock ([a-z]+)\n?$")
+	keys := readPageData(name, src, config)
+	setRe := regexp.MustCompile("^---set ([a-zA-Z]+) (.+)\n?$")
+	setBlockRe := regexp.MustCompile("^---set(markdown)?block ([a-zA-Z]+)\n?$")
 	setTemplateRe := regexp.MustCompile("^---settemplate ([a-z]+)\n?$")
+	unsetRe := regexp.MustCompile("^---unset ([a-zA-Z]+)\n?$")
+	sourceRe := regexp.MustCompile("^---source (\\S+)\n?$")
+	codeRe := regexp.MustCompile("^---code (\\S+)(?: (\\S+))?\n?$")
 
-	templateName := defaultTemplate
+	// Left empty, the kind of page decides
+	templateName := ""
+	var includes []string
 
-	f, err := os.Open(src)
+	f, err := openSrc(src)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	defer f.Close()
 	var contents bytes.Buffer
 
 	key := ""
 	value := ""
-	r := bufio.NewReader(f)
+	r := &lineReader{page: bufio.NewReader(f)}
 	for {
 		line, err := r.ReadBytes('\n')
 		if err != nil && err != io.EOF {
-			log.Fatal(err)
+			fatal(err)
 		}
 		matches := setRe.FindSubmatch(line)
 		if matches != nil {
 			key = string(matches[1])
 			value = string(matches[2])
+			checkReserved(name, key)
 			config[key] = value
+			keys = append(keys, key)
+			keepDirective(&contents, line)
+			if key == "parts" {
+				// The parts are read next, as if they were written here
+				includes = append(includes, r.readParts(name, src, value)...)
+			}
 			continue
 		}
 		matches = setBlockRe.FindSubmatch(line)
 		if matches != nil {
-			key = string(matches[1])
+			key = string(matches[2])
 			value = ""
+			checkReserved(name, key)
 			for {
 				line, err := r.ReadBytes('\n')
 				if err != nil && err != io.EOF {
-					log.Fatal(err)
+					fatal(err)
 				}
 				if bytes.Equal(line, []byte("---endblock\n")) {
 					break
 				}
 				if err == io.EOF {
-					// should never happen
+					warnPage(name, "---set"+string(matches[1])+"block "+key+" is not ended by ---endblock")
 					break
 				}
 				value += string(line)
 			}
+			if len(matches[1]) > 0 && !*noMarkdown && !directivesOnly {
+				value = string(markdownOutput(name, cachedMarkdown(name, markdownCommand(config), bytes.NewReader(markdownInput(name, []byte(value), config))), config))
+			}
 			config[key] = value
+			keys = append(keys, key)
+			keepDirective(&contents, line)
 			continue
 		}
 		matches = setTemplateRe.FindSubmatch(line)
 		if matches != nil {
 			templateName = string(matches[1])
-			fmt.Println("Setting template: " + templateName)
+			sayPage(name, "Setting template: "+templateName)
+			keepDirective(&contents, line)
+			continue
+		}
+		matches = unsetRe.FindSubmatch(line)
+		if matches != nil {
+			delete(config, string(matches[1]))
+			keepDirective(&contents, line)
+			continue
+		}
+		matches = sourceRe.FindSubmatch(line)
+		if matches != nil {
+			keepDirective(&contents, line)
+			if directivesOnly {
+				continue
+			}
+			b := fetchSource(name, string(matches[1]))
+			contents.Write(b)
+			if len(b) > 0 && b[len(b)-1] != '\n' {
+				contents.WriteByte('\n')
+			}
+			continue
+		}
+		matches = codeRe.FindSubmatch(line)
+		if matches != nil {
+			keepDirective(&contents, line)
+			if directivesOnly {
+				continue
+			}
+			b, file := includeCode(name, src, string(matches[1]), string(matches[2]))
+			contents.Write(b)
+			includes = append(includes, file)
 			continue
 		}
 		// normal line we should copy
@@ -199,42 +493,543 @@ func processPage(name string, src string, dst string, config config, templates m
 			break
 		}
 	}
-	b := convertMarkdown(&contents)
 
-	t, ok := templates[templateName]
-	if !ok {
-		log.Fatal("Template " + templateName + " not found.")
+	config["name"] = name
+	return &page{
+		name:     name,
+		src:      src,
+		config:   config,
+		template: templateName,
+		keys:     keys,
+		includes: includes,
+		body:     contents.Bytes(),
 	}
+}
 
-	// TODO: faster performance by not casting to string
-	config["name"] = name
-	config["content"] = string(b)
+// lineReader reads the lines of a page, and those of its parts from where
+// they are set. It knows which parts it is in the middle of, so one that is
+// read into itself, directly or through other parts, can be stopped.
+type lineReader struct {
+	page  *bufio.Reader
+	parts []*part
+}
+
+type part struct {
+	file    string
+	r       *bufio.Reader
+	started bool
+}
+
+func (r *lineReader) ReadBytes(delim byte) ([]byte, error) {
+	for len(r.parts) > 0 {
+		p := r.parts[len(r.parts)-1]
+		p.started = true
+		line, err := p.r.ReadBytes(delim)
+		if err != io.EOF {
+			return line, err
+		}
+		if len(line) > 0 {
+			// The part is left when the next line is read, so it is still
+			// being read while this one is
+			return append(line, delim), nil
+		}
+		r.parts = r.parts[:len(r.parts)-1]
+	}
+	return r.page.ReadBytes(delim)
+}
+
+// readParts has the files in the comma separated list parts, relative to
+// the directory of the page at src, read next, one after the other, and
+// returns their paths.
+func (r *lineReader) readParts(name string, src string, parts string) []string {
+	var files []string
+	var next []*part
+	for _, rel := range strings.Split(parts, ",") {
+		rel = strings.TrimSpace(rel)
+		file := filepath.Join(filepath.Dir(src), filepath.FromSlash(rel))
+		for _, p := range r.parts {
+			if p.started && p.file == file {
+				fatal("Reading the parts of " + name + ": " + rel + " is read into itself.")
+			}
+		}
+		b, err := readSrcFile(file)
+		if err != nil {
+			fatal("Reading the parts of " + name + ": " + err.Error())
+		}
+		next = append(next, &part{file: file, r: bufio.NewReader(bytes.NewReader(b))})
+		files = append(files, file)
+	}
+	// The first part goes on top
+	for i := len(next) - 1; i >= 0; i-- {
+		r.parts = append(r.parts, next[i])
+	}
+	return files
+}
+
+// readPageData merges the data file next to the page, post.page.json for
+// post.page, into config, so it can be overridden by ---set. It returns the
+// keys it set. Pages without one are left alone.
+func readPageData(name string, src string, config config) []string {
+	b, err := readSrcFile(src + ".json")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		fatal(err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		fatal("Reading data of " + name + ": " + err.Error())
+	}
+	var keys []string
+	for key, value := range data {
+		config[key] = cloneValue(value)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Keys that are filled in for every page after its directives are applied
+var reservedKeys = map[string]bool{
+	"name":          true,
+	"url":           true,
+	"outputFile":    true,
+	"data":          true,
+	"fingerprints":  true,
+	"content":       true,
+	"uses":          true,
+	"nonce":         true,
+	"recentChanges": true,
+	"printMode":     true,
+	"pages":         true,
+	"section":       true,
+	"resources":     true,
+	"kind":          true,
+	"excerpt":       true,
+}
+
+// checkReserved warns when page sets one of the reservedKeys, which would
+// silently be overwritten.
+func checkReserved(page string, key string) {
+	if reservedKeys[key] {
+		warnPage(page, "---set "+key+" has no effect, "+key+" is filled in by static")
+	}
+}
+
+// keepDirective writes the directive line to w as an HTML comment, if asked
+// to with -debug-directives.
+func keepDirective(w *bytes.Buffer, line []byte) {
+	if !*debugDirectives {
+		return
+	}
+	d := bytes.TrimRight(line, "\n")
+	d = bytes.Replace(d, []byte("-->"), []byte("-- >"), -1)
+	w.WriteString("<!-- ")
+	w.Write(d)
+	w.WriteString(" -->\n")
+}
+
+// render converts the page and executes its template, with funcs replacing
+// those set on it, if given. The result is kept, so rendering a page a second
+// time is free. Rendering it twice at once only costs the time.
+func (p *page) render(templates map[string]*template.Template, funcs template.FuncMap) []byte {
+	p.mu.Lock()
+	out := p.output
+	p.mu.Unlock()
+	if out != nil {
+		return out
+	}
+
+	p.fillContent()
+	t, used := findTemplate(p.templateName(templates), p.config, templates)
+	if *verbose {
+		sayPage(p.name, "Using template: "+used)
+	}
+	if funcs != nil {
+		clone, err := t.Clone()
+		if err != nil {
+			fatal("Rendering " + p.name + ": " + err.Error())
+		}
+		t = clone.Funcs(funcs)
+	}
 
-	var out bytes.Buffer
-	err = t.Execute(&out, config)
+	var b bytes.Buffer
+	err := t.Execute(&b, p.config)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Rendering " + p.name + ": " + err.Error())
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.output == nil {
+		p.output = b.Bytes()
+	}
+	return p.output
+}
+
+// fillContent converts the body and sets the "content" of the page and its
+// "excerpt", everything before the "summaryDivider" if it has one. It only
+// does so once.
+func (p *page) fillContent() {
+	if p.converted {
+		return
+	}
+	p.converted = true
+	b := p.convert()
+	// The transforms only make sense for HTML
+	if p.kind == kindHTML {
+		b = applyTransforms(p.config, b)
+		if configBool(p.config, "namespaceFootnotes") {
+			b = namespaceFootnotes(b, slugify(p.name))
+		}
+		if configBool(p.config, "imageDimensions") {
+			// The statics are in the output already
+			root := strings.TrimSuffix(p.dst, filepath.FromSlash(p.url))
+			b = addImageDimensions(b, root, p.url, p.config)
+		}
+		if len(srcsetWidths(p.config)) > 0 {
+			root := strings.TrimSuffix(p.dst, filepath.FromSlash(p.url))
+			b = addSrcsets(b, root, p.url, p.config)
+		}
+	}
+
+	// TODO: faster performance by not casting to string
+	p.config["content"] = string(b)
+	p.config["uses"] = contentUses(b)
+	p.config["excerpt"] = ""
+	if i := bytes.Index(b, []byte(summaryDivider(p.config))); i >= 0 {
+		p.config["excerpt"] = string(b[:i])
+	}
+}
+
+func summaryDivider(c config) string {
+	return configString(c, "summaryDivider", "<!--more-->")
+}
+
+// convert turns the body into content according to the "format" of the
+// page, "markdown" unless set otherwise, and notes the kind of content.
+func (p *page) convert() []byte {
+	format := configString(p.config, "format", "markdown")
+	if format == "markdown" && *noMarkdown {
+		format = "html"
 	}
+	switch format {
+	case "markdown":
+		p.kind = kindHTML
+		if !configBool(p.config, "math") {
+			return markdownOutput(p.name, cachedMarkdown(p.name, markdownCommand(p.config), bytes.NewReader(markdownInput(p.name, p.body, p.config))), p.config)
+		}
+		body, formulas := protectMath(markdownInput(p.name, p.body, p.config), p.config)
+		b := markdownOutput(p.name, cachedMarkdown(p.name, markdownCommand(p.config), bytes.NewReader(body)), p.config)
+		return restoreMath(p.name, b, formulas, p.config)
+	case "html":
+		p.kind = kindHTML
+	case "text":
+		p.kind = kindText
+	default:
+		fatal("Unknown format " + format + " for page " + p.name + ".")
+	}
+	return p.body
+}
 
-	f, err = os.Create(dst)
+func (p *page) write(templates map[string]*template.Template) {
+	key, cacheable := renderCacheKey(p, templates)
+	if cacheable {
+		if out, ok := cachedOutput(key); ok {
+			writeFile(p.dst, out)
+			return
+		}
+	}
+	warned := warningCount()
+	out := p.render(templates, nil)
+	if p.kind == kindHTML {
+		out = rewriteAssetRefs(out, p.url, p.config)
+		out = addAMPLink(out, p.config)
+	}
+	if *formatCmd != "" && p.kind == kindHTML {
+		out = filter("Formatting", p.name, strings.Fields(*formatCmd), bytes.NewReader(out), 0)
+	}
+	out = normalizeWhitespace(out, p.config, p.kind == kindHTML)
+	out = runMiddlewares(p, out)
+	if enc := outputEncoding(p.config); enc != "" {
+		out = encode(p.name, out, enc, p.kind == kindHTML)
+	}
+	// A page that warned is rendered again next time, to warn again
+	if cacheable && warningCount() == warned {
+		cacheOutput(key, out)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.dst), 0755); err != nil {
+		fatal(err)
+	}
+	f, err := os.Create(p.dst)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	defer f.Close()
-	io.Copy(f, &out)
+	f.Write(out)
+}
+
+// The kinds of pages, which pick a template of the same name if they don't
+// set one and the site has it: the home page, generated listings and all
+// other pages.
+const (
+	kindHome   = "home"
+	kindList   = "list"
+	kindSingle = "single"
+)
+
+func pageKind(name string) string {
+	if name == "index" {
+		return kindHome
+	}
+	return kindSingle
+}
+
+// templateName returns the template the page asked for with ---settemplate,
+// or else the one named after its kind, or else the default template.
+func (p *page) templateName(templates map[string]*template.Template) string {
+	if p.template != "" {
+		return p.template
+	}
+	if kind := configString(p.config, "kind", ""); templates[kind] != nil {
+		return kind
+	}
+	return configString(p.config, "defaultTemplate", defaultTemplate)
+}
+
+// findTemplate returns the template called name, or else the first existing
+// one listed in the "templateFallbacks" config key. It also returns the name
+// of the template that was found.
+func findTemplate(name string, config config, templates map[string]*template.Template) (*template.Template, string) {
+	t, n := lookupTemplate(name, config, templates)
+	if t == nil {
+		fatal("Template " + name + " not found.")
+	}
+	return t, n
 }
 
-func processPages(srcdir string, dstdir string, config config, templates map[string]*template.Template) {
-	fmt.Println("Processing pages:")
-	paths, err := filepath.Glob(filepath.Join(srcdir, "*.page"))
+// lookupTemplate is findTemplate without failing; it returns nil if there is
+// no suitable template.
+func lookupTemplate(name string, config config, templates map[string]*template.Template) (*template.Template, string) {
+	fallbacks := configList(config, "templateFallbacks")
+	for _, n := range append([]string{name}, fallbacks...) {
+		if t, ok := templates[n]; ok {
+			return t, n
+		}
+	}
+	return nil, ""
+}
+
+// readPages reads every page below srcdir, keyed by name, like readPage
+// does with directivesOnly.
+func readPages(srcdir string, dstdir string, config config, directivesOnly bool) map[string]*page {
+	var paths []string
+	err := walkSrc(srcdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, *pageExt) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+
+	pages := make(map[string]*page)
 	for _, path := range paths {
-		name := strings.TrimSuffix(filepath.Base(path), ".page")
-		fmt.Println("    " + name)
-		processPage(name, path, filepath.Join(dstdir, name+".html"), config, templates)
+		rel, err := filepath.Rel(srcdir, path)
+		if err != nil {
+			fatal(err)
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, *pageExt))
+		p := readPage(name, path, config, directivesOnly)
+		p.config["section"] = pageSection(name)
+		p.config["kind"] = pageKind(name)
+		switch {
+		case p.config["outputPath"] != nil:
+			p.url = cleanOutputPath(p)
+		case configString(p.config, "format", "") == "text":
+			p.url = name + ".txt"
+		case permalinkPattern(p) != "":
+			p.url = permalinkURL(p, permalinkPattern(p))
+		default:
+			p.url = outputURL(name, configString(config, "trailingSlash", ""))
+		}
+		p.url = caseOutputPath(p.url, config)
+		p.dst = filepath.Join(dstdir, filepath.FromSlash(p.url))
+		p.draft = configBool(p.config, "draft")
+		if filepath.Base(path) == "index"+*pageExt && filepath.Dir(rel) != "." {
+			p.config["resources"] = bundleResources(srcdir, filepath.Dir(path), config)
+		}
+		pages[name] = p
+	}
+	return pages
+}
+
+// cleanOutputPath returns the "outputPath" a page set for itself, making sure
+// it stays inside the output directory.
+func cleanOutputPath(p *page) string {
+	out := path.Clean(configString(p.config, "outputPath", ""))
+	if path.IsAbs(out) || out == "." || out == ".." || strings.HasPrefix(out, "../") {
+		fatal("Page " + p.name + " has outputPath " + out + ", which is not inside the output directory.")
+	}
+	return out
+}
+
+// checkCollisions stops the build if two pages would be written to the same
+// file.
+func checkCollisions(pages map[string]*page) {
+	seen := make(map[string]string)
+	for _, name := range sortedNames(pages) {
+		dst := pages[name].dst
+		if other, ok := seen[dst]; ok {
+			if strings.EqualFold(other, name) {
+				fatal("Pages " + other + " and " + name + " would both be written to " + dst + ", as \"lowercaseURLs\" is set.")
+			}
+			fatal("Pages " + other + " and " + name + " would both be written to " + dst + ".")
+		}
+		seen[dst] = name
+	}
+}
+
+// Only the pages in only are written, unless it is nil. All pages are read
+// regardless, as the written ones may embed any other page. Drafts are
+// written to previewdir, or left out entirely if that is empty. It returns
+// the pages of the site.
+func processPages(srcdir string, dstdir string, previewdir string, config config, templates map[string]*template.Template, only map[string]bool) map[string]*page {
+	say("Processing pages:")
+	pages := preparePages(srcdir, dstdir, previewdir, config, templates)
+	if only != nil {
+		addDependents(srcdir, pages, templates, only)
+	}
+	renderCacheHits, renderCacheMisses = 0, 0
+	for _, name := range sortedNames(pages) {
+		p := pages[name]
+		// Generated pages are cheap and may list changed pages
+		if only != nil && p.src != "" && !only[p.src] {
+			continue
+		}
+		say("    " + name)
+		p.write(templates)
+	}
+	sayRenderCacheStats()
+	writeFeeds(pages, dstdir, config)
+	writeHeaders(pages, dstdir, config)
+	writeRobots(dstdir, config)
+	if *lint {
+		lintPages(pages, templates)
+	}
+	if *textMirror {
+		writeTextMirror(pages, dstdir, config)
 	}
+	if *singlePage != "" {
+		writeSinglePage(pages, dstdir, *singlePage, config, templates)
+	}
+	return pages
+}
+
+// preparePages reads the pages of the site and works out everything about
+// them that doesn't depend on the others being rendered, down to their
+// content. From then on their configs and the templates are only read, so
+// the pages can be written in any order, or at once.
+func preparePages(srcdir string, dstdir string, previewdir string, config config, templates map[string]*template.Template) map[string]*page {
+	pages := readPages(srcdir, dstdir, config, false)
+	if *maintenance {
+		pages = maintenancePages(pages, dstdir)
+	}
+	for name, p := range pages {
+		if !p.draft {
+			continue
+		}
+		if previewdir == "" {
+			delete(pages, name)
+			continue
+		}
+		p.dst = filepath.Join(previewdir, filepath.FromSlash(p.url))
+	}
+	if configBool(config, "autoIndex") {
+		addAutoIndexes(pages, dstdir, config)
+	}
+	for _, p := range pages {
+		p.config["url"] = relURL(config, linkURL(p.url, configString(config, "trailingSlash", "")))
+		p.config["outputFile"] = outputFile(p.dst)
+		if nonceScope(config) == "page" {
+			p.config["nonce"] = newNonce()
+		}
+	}
+	list := pageList(pages, config)
+	for _, p := range pages {
+		p.config["pages"] = list
+	}
+	// Not listed, they are just another way to show the same pages
+	addAMPPages(pages, dstdir, config)
+	checkCollisions(pages)
+
+	// Listings show the content and excerpts of other pages, which rendering
+	// them can't be left to fill in: that would change configs other pages
+	// are reading.
+	for _, name := range sortedNames(pages) {
+		pages[name].fillContent()
+	}
+
+	// The templates are only changed here, before anything is rendered;
+	// executing them is safe from any number of goroutines.
+	filesdir := filepath.Join(srcdir, filepath.FromSlash(configString(config, "readFileDir", "")))
+	funcs := pageFuncs(pages, templates, filesdir, dstdir, config)
+	for _, t := range templates {
+		t.Funcs(funcs)
+	}
+	return pages
+}
+
+// The page that is the whole site with -maintenance
+const maintenancePage = "maintenance"
+
+// maintenancePages returns just the maintenance page, to be written as the
+// index of the site.
+func maintenancePages(pages map[string]*page, dstdir string) map[string]*page {
+	p, ok := pages[maintenancePage]
+	if !ok {
+		fatal("-maintenance needs a " + maintenancePage + *pageExt + " in the src directory.")
+	}
+	p.url = "index.html"
+	p.dst = filepath.Join(dstdir, p.url)
+	p.draft = false
+	return map[string]*page{maintenancePage: p}
+}
+
+func sortedNames(pages map[string]*page) []string {
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A directory with an index page is a page bundle. Its other files are
+// resources of that page, copied next to it by copyStatics, unless they are
+// ignored.
+func bundleResources(srcdir string, dir string, config config) []string {
+	ignore := configList(config, "ignore")
+	paths, err := globSrc(filepath.Join(dir, "*"))
+	if err != nil {
+		fatal(err)
+	}
+	var resources []string
+	for _, path := range paths {
+		info, err := statSrc(path)
+		if err != nil {
+			fatal(err)
+		}
+		if info.IsDir() || strings.HasSuffix(path, *pageExt) || matchesName(ignore, relSlash(srcdir, path)) {
+			continue
+		}
+		resources = append(resources, filepath.Base(path))
+	}
+	return resources
 }
 
 func copyFile(src string, dst string) {
@@ -242,40 +1037,406 @@ func copyFile(src string, dst string) {
 		return
 	}
 
-	fin, err := os.Open(src)
+	fin, err := openSrc(src)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	defer fin.Close()
 	fout, err := os.Create(dst)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	defer fout.Close()
-	io.Copy(fout, fin)
+	if _, err := io.Copy(fout, fin); err != nil {
+		fatal("Copying " + src + ": " + err.Error())
+	}
+
+	// Keep the time of the source, for anything looking at the output
+	if info, err := fin.Stat(); err == nil {
+		os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
 }
 
-// TODO: make nested dirs possible
-func copyStatics(srcdir string, dstdir string) {
-	matches, err := filepath.Glob(filepath.Join(srcdir, "*"))
+// symlinkPolicy returns what to do with statics that are symlinks, from the
+// "symlinks" config key: "follow" to copy what they point to, which is the
+// default, "preserve" to make the same link in the output, or "skip" to
+// leave them out.
+func symlinkPolicy(config config) string {
+	policy := configString(config, "symlinks", "follow")
+	if policy != "follow" && policy != "preserve" && policy != "skip" {
+		fatal("Unknown symlinks policy " + policy + ", it should be follow, preserve or skip.")
+	}
+	return policy
+}
+
+func isSymlink(path string) bool {
+	info, err := lstatSrc(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// copySymlink makes dst a symlink to where the symlink src points.
+func copySymlink(src string, dst string) {
+	target, err := readlinkSrc(src)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		fatal(err)
 	}
-	for _, match := range matches {
-		if strings.HasSuffix(match, ".page") || strings.HasSuffix(match, ".template") || filepath.Base(match) == "config.json" {
+	if err := os.Symlink(target, dst); err != nil {
+		fatal(err)
+	}
+}
+
+// The directories the build in progress writes to: the output, its -atomic
+// directory and the -preview one
+var outputDirs []string
+
+// isOutputDir reports whether dir is the cache or one of outputDirs, which
+// hold no sources even when they are below the src directory.
+func isOutputDir(dir string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fatal(err)
+	}
+	for _, d := range append([]string{*cacheDir}, outputDirs...) {
+		if d == "" {
+			continue
+		}
+		if d, err = filepath.Abs(d); err != nil {
+			fatal(err)
+		}
+		if d == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// listStatics returns the paths, relative to srcdir, of the files that are
+// copied to the output as they are.
+func listStatics(srcdir string, config config) []string {
+	minSuffix := configString(config, "minSuffix", ".min")
+	ignore := configList(config, "ignore")
+	policy := symlinkPolicy(config)
+	// The directories being walked, as they really are, so a symlink to one
+	// of them isn't followed round and round
+	walking := make(map[string]bool)
+	if real, err := filepath.EvalSymlinks(srcdir); err == nil {
+		walking[real] = true
+	}
+	var statics []string
+	var visit filepath.WalkFunc
+	visit = func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcdir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel == dataDir || isOutputDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, *pageExt) || strings.HasSuffix(path, *pageExt+".json") || strings.HasSuffix(path, ".template") || rel == configFile || rel == schemaFile || rel == markerFile {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if policy == "skip" {
+				return nil
+			}
+			if target, err := statSrc(path); err == nil && target.IsDir() && policy == "follow" {
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				if walking[real] {
+					fatal("Following symlinks: " + path + " points to a directory it is in.")
+				}
+				walking[real] = true
+				defer delete(walking, real)
+				// With a trailing separator the link itself is walked into
+				return walkSrc(path+string(filepath.Separator), visit)
+			}
+		}
+		if !wantStatic(path, minSuffix) || matchesName(ignore, filepath.ToSlash(rel)) {
+			return nil
+		}
+		statics = append(statics, rel)
+		return nil
+	}
+	if err := walkSrc(srcdir, visit); err != nil {
+		fatal(err)
+	}
+	return statics
+}
+
+// staticOutputPaths maps the statics, relative to srcdir, to where they are
+// copied in the output, with forward slashes. That is the same place, but
+// with "lowercaseURLs" set the part of their directory that holds pages is
+// lowercased like the pages are, so the resources of a page bundle, or any
+// file next to a page, can still be linked to relative to the page.
+func staticOutputPaths(srcdir string, statics []string, config config) map[string]string {
+	outputs := make(map[string]string, len(statics))
+	lower := configBool(config, "lowercaseURLs")
+	var dirs map[string]bool
+	if lower {
+		dirs = pageDirs(srcdir)
+	}
+	for _, rel := range statics {
+		rel = filepath.ToSlash(rel)
+		out := rel
+		if lower {
+			for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+				if dirs[dir] {
+					out = strings.ToLower(dir) + rel[len(dir):]
+					break
+				}
+			}
+		}
+		outputs[rel] = out
+	}
+	return outputs
+}
+
+// pageDirs returns the directories below srcdir, with forward slashes, that
+// have pages in them.
+func pageDirs(srcdir string) map[string]bool {
+	dirs := make(map[string]bool)
+	err := walkSrc(srcdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, *pageExt) {
+			return err
+		}
+		dirs[filepath.ToSlash(filepath.Dir(relSlash(srcdir, path)))] = true
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+	return dirs
+}
+
+// Only the statics in only are copied, unless it is nil. It returns the
+// names the fingerprinted statics are shipped under, which are the same for
+// all of them either way.
+func copyStatics(srcdir string, dstdir string, config config, only map[string]bool) map[string]string {
+	statics := listStatics(srcdir, config)
+	outputs := staticOutputPaths(srcdir, statics, config)
+	names := fingerprints(srcdir, statics, outputs, config)
+	policy := symlinkPolicy(config)
+	for _, rel := range statics {
+		if only != nil && !only[filepath.Join(srcdir, rel)] {
+			continue
+		}
+		if filepath.Ext(rel) == ".map" && configBool(config, "stripSourceMaps") {
+			continue
+		}
+		out := outputs[filepath.ToSlash(rel)]
+		if hashed, ok := names[out]; ok {
+			out = hashed
+		}
+		dst := filepath.Join(dstdir, filepath.FromSlash(out))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			fatal(err)
+		}
+		if policy == "preserve" && isSymlink(filepath.Join(srcdir, rel)) {
+			copySymlink(filepath.Join(srcdir, rel), dst)
+			continue
+		}
+		if args := minifier(rel, config); len(args) > 0 {
+			minifyFile(filepath.Join(srcdir, rel), dst, args, config)
 			continue
 		}
-		copyFile(match, filepath.Join(dstdir, filepath.Base(match)))
+		copyFile(filepath.Join(srcdir, rel), dst)
+	}
+	return names
+}
+
+// wantStatic decides between the minified and the readable version of an
+// asset, when both exist: production builds ship app.min.js and skip app.js,
+// other builds do the opposite.
+func wantStatic(path string, minSuffix string) bool {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	if strings.HasSuffix(base, minSuffix) {
+		_, err := statSrc(strings.TrimSuffix(base, minSuffix) + ext)
+		return *env == "prod" || err != nil
+	}
+	_, err := statSrc(base + minSuffix + ext)
+	return *env != "prod" || err != nil
+}
+
+// prepareConfig adds what the command line and the build itself know to
+// the config of the site in srcdir.
+func prepareConfig(srcdir string, config config) {
+	config["env"] = *env
+	config["buildVersion"] = gitVersion(srcdir)
+	config["buildTime"] = time.Now().Format(time.RFC3339)
+	config["data"] = readData(srcdir, config)
+	limit := 20
+	if config["recentChangesLimit"] != nil {
+		limit = int(configNumber(config, "recentChangesLimit"))
+	}
+	config["recentChanges"] = recentChanges(srcdir, limit)
+	// Only the -singlepage export is for printing
+	config["printMode"] = false
+	if nonceScope(config) != "" {
+		config["nonce"] = newNonce()
+	}
+	if *defaultTemplateFlag != "" {
+		config["defaultTemplate"] = *defaultTemplateFlag
+	}
+	if *baseURL != "" {
+		config["baseurl"] = *baseURL
+	}
+}
+
+func checkDefaultTemplate(config config, templates map[string]*template.Template) {
+	if name, ok := config["defaultTemplate"].(string); ok && templates[name] == nil {
+		fatal("Default template " + name + " not found, there is no " + name + ".template.")
+	}
+}
+
+// build renders the site in srcdir into dstdir.
+func build(srcdir string, dstdir string, config config, templates map[string]*template.Template) {
+	checkMarker(srcdir, config)
+	checkPages(srcdir)
+	previewdir := ""
+	if *preview {
+		previewdir = *previewDst
+		if previewdir == "" {
+			previewdir = filepath.Clean(dstdir) + "-preview"
+		}
+	}
+	outputDirs = []string{dstdir, atomicDirName(dstdir), previewdir}
+	defer func() { outputDirs = nil }()
+	var only map[string]bool
+	switch {
+	case *since != "":
+		only = changedPages(srcdir, *since)
+	case *sinceLastBuild:
+		only = changedSinceState(srcdir, dstdir)
+	}
+	outdir := dstdir
+	swapping := false
+	if *atomic {
+		if *since != "" || *sinceLastBuild {
+			fatal("-atomic can't be combined with -since or -since-mtime, which update the output in place.")
+		}
+		outdir = atomicDir(dstdir)
+		atomicBuild.dir, atomicBuild.dstdir = outdir, dstdir
+		defer func() { atomicBuild.dir, atomicBuild.dstdir = "", "" }()
+		// A failed build takes what it wrote along, unless it failed while
+		// swapping, when the files to keep may have been moved over already
+		defer func() {
+			if r := recover(); r != nil {
+				if !swapping {
+					os.RemoveAll(outdir)
+				}
+				panic(r)
+			}
+		}()
+	}
+	// A partial build has to keep the pages it doesn't touch
+	if only == nil {
+		clearDir(outdir, configList(config, "keep"))
+		if previewdir != "" {
+			clearDir(previewdir, configList(config, "keep"))
+		}
+	}
+	// Statics go first, so templates can look at what is shipped
+	config["fingerprints"] = copyStatics(srcdir, outdir, config, only)
+	if previewdir != "" {
+		// Drafts should look like they will once published
+		copyStatics(srcdir, previewdir, config, only)
+	}
+	pages := processPages(srcdir, outdir, previewdir, config, templates, only)
+	if *orphans {
+		warnOrphans(srcdir, outdir, config)
+	}
+	// Before the state is written, so the next build warns again
+	checkWarnings()
+	if *sinceLastBuild {
+		writeState(srcdir, outdir, pageDeps(srcdir, pages, templates), pages)
+	}
+	if *atomic {
+		swapping = true
+		swapDir(outdir, dstdir, configList(config, "keep"))
+	}
+	if !*noCache {
+		pruneCache()
 	}
 }
 
-func main() {
-	flag.Parse()
-	fmt.Println("Running static...")
-	checkRequirements()
-	config := readConfig(*srcDir)
-	templates := readTemplates(*srcDir)
-	clearDir(*dstDir)
-	processPages(*srcDir, *dstDir, config, templates)
-	copyStatics(*srcDir, *dstDir)
+// Run runs static with the arguments of its command line, without the name
+// of the program, like "-src site -serve".
+func Run(args []string) (err error) {
+	defer catch(&err)
+	Flags.Parse(args)
+	if *list && *listJSON || *metadata {
+		// Keep stdout for the listing itself
+		sayTo = os.Stderr
+	}
+	say("Running static...")
+	stopProfiling := startProfiling()
+	defer stopProfiling()
+	srcdir := *srcDir
+	if strings.HasSuffix(srcdir, ".zip") {
+		var closeSource func()
+		srcdir, closeSource = openSource(srcdir)
+		defer closeSource()
+	}
+	if *sitesFile != "" {
+		if *list || *metadata || *archive != "" || *serve || *baseURL != "" {
+			fatal("-sites can't be combined with -list, -metadata, -archive, -serve or -baseurl.")
+		}
+		buildSites(*sitesFile)
+		return nil
+	}
+	if *metadata {
+		printMetadata(srcdir, *dstDir)
+		return nil
+	}
+	if *list {
+		config, templates := loadSite(srcdir)
+		checkPages(srcdir)
+		listSite(srcdir, *dstDir, config, templates)
+		return nil
+	}
+	if *verify {
+		if *since != "" || *sinceLastBuild || *preview {
+			fatal("-verify can't be combined with -since, -since-mtime or -preview.")
+		}
+		config, templates := loadSite(srcdir)
+		verifyBuild(srcdir, config, templates)
+		return nil
+	}
+	if *watchConfig && (!*serve || *since != "" || srcdir != *srcDir) {
+		fatal("-watch-config only works with -serve, without -since and for a src directory.")
+	}
+	if err := Build(srcdir, *dstDir); err != nil {
+		return err
+	}
+	if *archive != "" {
+		writeArchive(*dstDir, *archive)
+	}
+	if *serve {
+		if *watchConfig {
+			stop, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				watchConfigFiles(srcdir, *dstDir, stop)
+				close(done)
+			}()
+			// Stopping halfway through a rebuild would leave half an output
+			defer func() {
+				close(stop)
+				<-done
+			}()
+		}
+		serveDir(*dstDir)
+	}
+	return nil
 }
@@ -0,0 +1,143 @@
+package static
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A transform rewrites the HTML produced by convertMarkdown before it is
+// handed to the template.
+type transform func(b []byte) []byte
+
+var transforms = map[string]transform{
+	"lazyImages":          lazyImages,
+	"headingAnchors":      headingAnchors,
+	"headingLinks":        headingLinks,
+	"externalLinksNewTab": externalLinksNewTab,
+	"emoji":               emoji,
+	"amp":                 amp,
+}
+
+var (
+	imgRe     = regexp.MustCompile(`<img\b[^>]*>`)
+	headingRe = regexp.MustCompile(`(?s)<h([1-6])([^>]*)>(.*?)</h[1-6]>`)
+	linkRe    = regexp.MustCompile(`<a\b[^>]*>`)
+	tagRe     = regexp.MustCompile(`<[^>]*>`)
+	slugRe    = regexp.MustCompile(`[^a-z0-9]+`)
+	idValueRe = regexp.MustCompile(`\bid\s*=\s*["']([^"']*)["']`)
+	hrefRe    = regexp.MustCompile(`\bhref\s*=\s*["']?(https?:)?//`)
+	// As written by cmark-gfm (fn-1, fnref-1) and others (fn:1, fnref:1)
+	footnoteRe = regexp.MustCompile(`\b(id|href)="(#?)(fn(?:ref)?[-:][^"]*)"`)
+)
+
+// applyTransforms runs the transforms listed under the "transforms" config
+// key, in order.
+func applyTransforms(c config, b []byte) []byte {
+	for _, name := range configList(c, "transforms") {
+		t, ok := transforms[name]
+		if !ok {
+			fatal("Unknown transform " + name + ".")
+		}
+		b = t(b)
+	}
+	return b
+}
+
+// namespaceFootnotes prefixes the ids of footnotes and the links to them with
+// prefix, so the footnotes of several pages shown together, as in a feed,
+// don't get mixed up.
+func namespaceFootnotes(b []byte, prefix string) []byte {
+	return footnoteRe.ReplaceAll(b, []byte(`${1}="${2}`+prefix+`-${3}"`))
+}
+
+func lazyImages(b []byte) []byte {
+	return imgRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		if bytes.Contains(tag, []byte("loading=")) {
+			return tag
+		}
+		return addAttr(tag, `loading="lazy"`)
+	})
+}
+
+func externalLinksNewTab(b []byte) []byte {
+	return linkRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		if !hrefRe.Match(tag) || bytes.Contains(tag, []byte("target=")) {
+			return tag
+		}
+		return addAttr(tag, `target="_blank" rel="noopener"`)
+	})
+}
+
+// headingAnchors gives every heading without an id one derived from its
+// text, so sections can be linked to.
+func headingAnchors(b []byte) []byte {
+	return addHeadingIDs(b, false)
+}
+
+// headingLinks does what headingAnchors does, and also puts a link to the
+// heading in front of its text.
+func headingLinks(b []byte) []byte {
+	return addHeadingIDs(b, true)
+}
+
+func addHeadingIDs(b []byte, link bool) []byte {
+	ids := newSlugger()
+	return headingRe.ReplaceAllFunc(b, func(h []byte) []byte {
+		m := headingRe.FindSubmatch(h)
+		attrs, text := string(m[2]), string(m[3])
+		var id string
+		if am := idValueRe.FindStringSubmatch(attrs); am != nil {
+			id = am[1]
+			ids[id] = true
+		} else {
+			id = ids.slug(string(tagRe.ReplaceAll(m[3], nil)))
+			attrs += ` id="` + id + `"`
+		}
+		if link {
+			text = `<a class="anchor" href="#` + id + `" aria-hidden="true">#</a>` + text
+		}
+		return []byte(fmt.Sprintf(`<h%s%s>%s</h%s>`, m[1], attrs, text, m[1]))
+	})
+}
+
+// A slugger hands out slugs that are unique within one page, adding -1, -2
+// and so on when texts repeat. Anything linking to headings should use it, so
+// that the links match the ids.
+type slugger map[string]bool
+
+func newSlugger() slugger {
+	return make(slugger)
+}
+
+func (s slugger) slug(text string) string {
+	base := slugify(text)
+	id := base
+	for n := 1; s[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	s[id] = true
+	return id
+}
+
+func slugify(s string) string {
+	s = slugRe.ReplaceAllString(strings.ToLower(s), "-")
+	return strings.Trim(s, "-")
+}
+
+// addAttr inserts attr right before the closing bracket of tag.
+func addAttr(tag []byte, attr string) []byte {
+	end := len(tag) - 1
+	if bytes.HasSuffix(tag, []byte("/>")) {
+		end--
+	}
+	out := make([]byte, 0, len(tag)+len(attr)+1)
+	out = append(out, bytes.TrimRight(tag[:end], " ")...)
+	out = append(out, ' ')
+	out = append(out, attr...)
+	if end < len(tag)-1 {
+		out = append(out, ' ')
+	}
+	return append(out, tag[end:]...)
+}
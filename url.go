@@ -0,0 +1,119 @@
+package static
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Values of the "trailingSlash" config key. Without one, pages are written
+// as name.html and linked to as such, except for index pages, which are
+// linked to by their directory.
+const (
+	// Every page is written as name/index.html and linked to as name/
+	slashAlways = "always"
+	// Pages are linked to without .html and directories without a slash
+	slashNever = "never"
+)
+
+// outputURL returns the path the page called name is written to, relative
+// to the output directory.
+func outputURL(name string, policy string) string {
+	if policy == slashAlways && path.Base(name) != "index" {
+		return name + "/index.html"
+	}
+	return name + ".html"
+}
+
+// caseOutputPath returns the output path u of a page lowercased if the site
+// has "lowercaseURLs" set, for hosts that tell About.html and about.html
+// apart.
+func caseOutputPath(u string, c config) string {
+	if configBool(c, "lowercaseURLs") {
+		return strings.ToLower(u)
+	}
+	return u
+}
+
+// linkURL returns the path to link to for the output path u, relative to the
+// site root.
+func linkURL(u string, policy string) string {
+	if path.Base(u) == "index.html" {
+		u = strings.TrimSuffix(u, "index.html")
+	} else if policy == slashNever {
+		u = strings.TrimSuffix(u, ".html")
+	}
+	return applySlash(u, policy)
+}
+
+// applySlash makes the link path u follow policy. Links to files with an
+// extension are left alone.
+func applySlash(u string, policy string) string {
+	switch policy {
+	case slashAlways:
+		if u != "" && !strings.HasSuffix(u, "/") && path.Ext(u) == "" {
+			u += "/"
+		}
+	case slashNever:
+		u = strings.TrimSuffix(u, "/")
+	}
+	return u
+}
+
+// relativeURL returns a link to the output path to, relative to the page
+// at the output path from.
+func relativeURL(from string, to string, policy string) string {
+	target := linkURL(to, policy)
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(from)), filepath.FromSlash(strings.TrimSuffix(target, "/")))
+	if err != nil {
+		// Both are relative to the site root, so this can't happen
+		panic(err)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return "./"
+	}
+	// The root is linked to as a directory, whatever the policy
+	if target == "" || strings.HasSuffix(target, "/") {
+		rel += "/"
+	}
+	return rel
+}
+
+// absURL returns the full URL of the site root relative path u, based on
+// the "baseurl" config key.
+func absURL(c config, u string) string {
+	base := strings.TrimSuffix(configString(c, "baseurl", ""), "/")
+	return base + "/" + applySlash(strings.TrimPrefix(u, "/"), configString(c, "trailingSlash", ""))
+}
+
+// relURL returns u as an absolute path on the host the site is served from,
+// keeping any path prefix of the "baseurl" config key.
+func relURL(c config, u string) string {
+	prefix := ""
+	if base, err := url.Parse(configString(c, "baseurl", "")); err == nil {
+		prefix = strings.TrimSuffix(base.Path, "/")
+	}
+	return prefix + "/" + applySlash(strings.TrimPrefix(u, "/"), configString(c, "trailingSlash", ""))
+}
+
+// localPath returns the output path, relative to the output directory, that
+// the link u on the page at the output path from points to. It reports false
+// for links to other sites or outside the "baseurl".
+func localPath(u *url.URL, from string, c config) (string, bool) {
+	if u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return path.Join(path.Dir(from), u.Path), true
+	}
+	prefix := ""
+	if base, err := url.Parse(configString(c, "baseurl", "")); err == nil {
+		prefix = strings.TrimSuffix(base.Path, "/")
+	}
+	if !strings.HasPrefix(u.Path, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(u.Path, prefix+"/"), true
+}
@@ -0,0 +1,25 @@
+package static
+
+import "regexp"
+
+var (
+	codeLangRe = regexp.MustCompile(`<code[^>]*\bclass="[^"]*\blanguage-([a-zA-Z0-9_+-]+)`)
+	// Formulas as restoreMath leaves them, or as rendered by KaTeX
+	mathUseRe = regexp.MustCompile(`\bclass="(?:math (?:inline|display)|katex)\b`)
+)
+
+// contentUses returns what the HTML content of a page needs scripts or
+// styles for, as {{.uses}}: "math" if it has formulas, and the language of
+// every fenced code block, like "mermaid" or "go". Templates can then load
+// KaTeX or Mermaid only where they are needed, with {{if .uses.mermaid}}.
+// Static has no shortcodes, so these are the only things tracked.
+func contentUses(b []byte) map[string]interface{} {
+	uses := make(map[string]interface{})
+	if mathUseRe.Match(b) {
+		uses["math"] = true
+	}
+	for _, m := range codeLangRe.FindAllSubmatch(b, -1) {
+		uses[string(m[1])] = true
+	}
+	return uses
+}
@@ -0,0 +1,90 @@
+package static
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+var verify = Flags.Bool("verify", false, "build twice into temporary directories and fail if the output differs")
+
+// verifyBuild builds srcdir twice and compares the results file by file, to
+// catch output that depends on map order or the like. The config and
+// templates are shared, so the build time is the same for both. Converted
+// markdown and rendered pages aren't taken from the cache, or the second
+// build would repeat what the first one did instead of doing it again.
+func verifyBuild(srcdir string, config config, templates map[string]*template.Template) {
+	defer func(was bool) { *noCache = was }(*noCache)
+	*noCache = true
+
+	tmp, err := ioutil.TempDir("", "static-verify")
+	if err != nil {
+		fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	a, b := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	for _, dir := range []string{a, b} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			fatal(err)
+		}
+		build(srcdir, dir, config, templates)
+	}
+
+	differ := diffDirs(a, b)
+	if len(differ) == 0 {
+		say("Both builds are the same.")
+		return
+	}
+	for _, name := range differ {
+		sayProblem("Differs between builds: " + name)
+	}
+	os.RemoveAll(tmp)
+	fatal(fmt.Sprintf("The output is not reproducible, %d files differ.", len(differ)))
+}
+
+// diffDirs returns the paths, relative to the directories, of the files that
+// are only in one of a and b, or differ in contents.
+func diffDirs(a string, b string) []string {
+	fa, fb := readTree(a), readTree(b)
+	var differ []string
+	for name, ca := range fa {
+		if cb, ok := fb[name]; !ok || !bytes.Equal(ca, cb) {
+			differ = append(differ, name)
+		}
+	}
+	for name := range fb {
+		if _, ok := fa[name]; !ok {
+			differ = append(differ, name)
+		}
+	}
+	sort.Strings(differ)
+	return differ
+}
+
+func readTree(dir string) map[string][]byte {
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+	return files
+}
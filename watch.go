@@ -0,0 +1,63 @@
+package static
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var watchConfig = Flags.Bool("watch-config", false, "with -serve, rebuild everything when config.json or its schema change")
+
+// How often watchConfigFiles looks at the config
+const watchInterval = time.Second
+
+// The files every page depends on
+var configFiles = []string{configFile, schemaFile}
+
+// watchConfigFiles rebuilds the site in srcdir into dstdir from scratch
+// whenever one of the configFiles changes, until stop is closed. The render
+// cache is cleared first, as nothing rendered before can be trusted. A
+// rebuild that fails is reported, and the next change is waited for as
+// before: the server is still running, and the change may be a typo.
+func watchConfigFiles(srcdir string, dstdir string, stop <-chan struct{}) {
+	last := configHash(srcdir)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		hash := configHash(srcdir)
+		if hash == last {
+			continue
+		}
+		last = hash
+		say("The config changed, doing a full rebuild.")
+		if err := os.RemoveAll(filepath.Join(*cacheDir, "pages")); err != nil {
+			sayProblem("Not rebuilding, the render cache can't be cleared: " + err.Error())
+			continue
+		}
+		if err := Build(srcdir, dstdir); err != nil {
+			sayProblem("The rebuild failed: " + err.Error())
+		}
+	}
+}
+
+// configHash returns a hash of the contents of the configFiles in srcdir,
+// so a change is seen even if it keeps the modification time.
+func configHash(srcdir string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, name := range configFiles {
+		// Gone counts as empty
+		b, _ := readSrcFile(filepath.Join(srcdir, name))
+		h.Write([]byte(name + "\x00"))
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
@@ -0,0 +1,49 @@
+package static
+
+import (
+	"bytes"
+	"regexp"
+)
+
+var (
+	preRe                = regexp.MustCompile(`(?s)<pre\b.*?</pre>`)
+	trailingWhitespaceRe = regexp.MustCompile(`(?m)[ \t]+$`)
+)
+
+// normalizeWhitespace applies the whitespace policy of the config to the
+// output of a page, as an .editorconfig would to a file: with
+// "trimTrailingWhitespace" set, lines lose their trailing spaces and tabs,
+// and with "insertFinalNewline" the output ends in exactly one newline. In
+// HTML, what is inside <pre> is left untouched. Both are off by default, so
+// output is exactly what the templates make of it.
+func normalizeWhitespace(b []byte, c config, html bool) []byte {
+	if configBool(c, "trimTrailingWhitespace") {
+		parts := []codeSplit{{text: b}}
+		if html {
+			parts = splitCode(b, preRe)
+		}
+		var out bytes.Buffer
+		for i, s := range parts {
+			if s.code {
+				out.Write(s.text)
+				continue
+			}
+			text := s.text
+			// The end of the line may be in the next part
+			if i+1 < len(parts) {
+				if j := bytes.LastIndexByte(text, '\n'); j >= 0 {
+					out.Write(trailingWhitespaceRe.ReplaceAll(text[:j], nil))
+					text = text[j:]
+				}
+				out.Write(text)
+				continue
+			}
+			out.Write(trailingWhitespaceRe.ReplaceAll(text, nil))
+		}
+		b = out.Bytes()
+	}
+	if configBool(c, "insertFinalNewline") && len(b) > 0 {
+		b = append(bytes.TrimRight(b, "\n"), '\n')
+	}
+	return b
+}